@@ -5,7 +5,8 @@ import "C"
 
 // ArgSpec defines how many arguments a function should take and
 // what kind. Multiple ArgSpecs can be combined using the "|"
-// operator.
+// operator. Calling a method defined in Go with a number of arguments
+// its ArgSpec doesn't allow raises ArgumentError, the block isn't counted.
 type ArgSpec C.mrb_aspec
 
 // ArgsAny allows any number of arguments.
@@ -0,0 +1,320 @@
+package gruby
+
+import (
+	"reflect"
+)
+
+// futureVariable holds the handle of the Go work of a pending GRuby::Future,
+// futureValueVariable and futureErrorVariable its outcome once it is
+// resolved. They have no @ so scripts can't see or change them.
+const (
+	futureVariable      = "__future"
+	futureValueVariable = "__future_value"
+	futureErrorVariable = "__future_error"
+)
+
+// asyncCode defines the fiber scheduler of GRuby::Async and completes
+// GRuby::Future, whose other methods are defined in Go.
+const asyncCode = `
+class GRuby::Future
+  def value
+    GRuby::Async.await(self)
+    __result
+  end
+
+  class << self
+    undef_method :new
+  end
+end
+
+module GRuby::Async
+  class Task
+    attr_reader :waiting
+
+    def initialize(&block)
+      @fiber = Fiber.new(&block)
+      @waiting = nil
+      @done = false
+      @value = nil
+      @error = nil
+    end
+
+    def done?
+      @done
+    end
+
+    def ready?
+      @waiting.nil? || @waiting.done?
+    end
+
+    def value
+      GRuby::Async.await(self)
+      raise FiberError, "the task can't finish outside GRuby::Async.run" unless @done
+      raise @error if @error
+
+      @value
+    end
+
+    def __step
+      @waiting = nil
+      previous = GRuby::Async.current
+      GRuby::Async.current = self
+      begin
+        result = @fiber.resume
+      rescue Exception => e
+        @error = e
+        @done = true
+        return
+      ensure
+        GRuby::Async.current = previous
+      end
+
+      if @fiber.alive?
+        @waiting = result if result.respond_to?(:done?)
+      else
+        @value = result
+        @done = true
+      end
+    end
+  end
+
+  @current = nil
+  @tasks = nil
+
+  class << self
+    attr_accessor :current
+
+    def run(&block)
+      raise FiberError, "GRuby::Async.run can't be nested" if @tasks
+
+      @tasks = []
+      main = async(&block)
+      begin
+        until @tasks.empty?
+          ready = @tasks.select(&:ready?)
+          if ready.empty?
+            futures = @tasks.map(&:waiting).select { |waiting| waiting.is_a?(GRuby::Future) }
+            raise FiberError, "deadlock: the tasks wait for each other" if futures.empty?
+
+            GRuby::Future.__wait_any(futures)
+          else
+            ready.each(&:__step)
+            @tasks.reject!(&:done?)
+          end
+        end
+      ensure
+        @tasks = nil
+      end
+
+      main.value
+    end
+
+    def async(&block)
+      raise FiberError, "GRuby::Async.async must be called within GRuby::Async.run" unless @tasks
+
+      task = Task.new(&block)
+      @tasks << task
+      task
+    end
+
+    def await(awaitable)
+      Fiber.yield(awaitable) if @current && !awaitable.done?
+    end
+
+    def __define(mod, name)
+      mod.__send__(:define_method, name) do |*args, &block|
+        __send__(:"__async_#{name}", *args, &block).value
+      end
+    end
+  end
+end
+`
+
+// AsyncFunc is the signature of a Go method whose work runs in a goroutine,
+// see DefineAsyncMethod. It runs like a Func and returns the work to run,
+// which must not use the VM, or an exception to raise.
+type AsyncFunc func(grb *GRuby, self Value) (func() (any, error), Value)
+
+type future struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// Async runs fn in a new goroutine and returns a GRuby::Future for its
+// result. It is meant to be returned by Go methods doing slow work like
+// network calls, fn must not use the VM.
+//
+// Calling value on the future returns the result of fn converted to Ruby
+// like a Go value returned to Ruby, or raises a RuntimeError with the message
+// of the error fn returned. Outside a task it blocks the VM until fn
+// returns. Within a task of GRuby::Async.run it suspends the task instead,
+// letting the other tasks run meanwhile:
+//
+//	GRuby::Async.run do
+//	  users = GRuby::Async.async { db.query("SELECT * FROM users").value }
+//	  posts = GRuby::Async.async { db.query("SELECT * FROM posts").value }
+//
+//	  [users.value, posts.value] # both queries run concurrently
+//	end
+//
+// Tasks are fibers, so a task can't be suspended while running a block
+// called from Go, for instance with Yield. The result of a future that is
+// never awaited is dropped when the future is garbage collected.
+func (g *GRuby) Async(fn func() (any, error)) (Value, error) {
+	class, err := g.futureClass()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := class.New()
+	if err != nil {
+		return nil, err
+	}
+
+	work := &future{done: make(chan struct{}), value: nil, err: nil}
+
+	value.SetInstanceVariable(futureVariable, g.newHandle(work))
+
+	go func() {
+		defer close(work.done)
+
+		work.value, work.err = fn()
+	}()
+
+	return value, nil
+}
+
+// DefineAsyncMethod defines an instance method on the class whose work runs
+// in a goroutine, see Async. The method waits for the work itself, so
+// scripts call it like any other method and tasks calling it are
+// suspended until it is done:
+//
+//	class.DefineAsyncMethod("fetch", func(grb *gruby.GRuby, self gruby.Value) (func() (any, error), gruby.Value) {
+//		url := gruby.MustToGo[string](grb.GetArgs()[0])
+//
+//		return func() (any, error) { return fetch(url) }, nil
+//	}, gruby.ArgsReq(1))
+//
+// The Go method is defined as __async_<name> and returns the future.
+func (c *Class) DefineAsyncMethod(name string, fn AsyncFunc, spec ArgSpec, capabilities ...string) error {
+	grb := c.GRuby()
+
+	if _, err := grb.futureClass(); err != nil {
+		return err
+	}
+
+	c.DefineMethod("__async_"+name, func(grb *GRuby, self Value) (Value, Value) {
+		work, exc := fn(grb, self)
+		if exc != nil {
+			return nil, exc
+		}
+
+		value, err := grb.Async(work)
+		if err != nil {
+			return nil, grb.newError(grb.Class("RuntimeError", nil), err.Error())
+		}
+
+		return value, nil
+	}, spec, capabilities...)
+
+	_, err := grb.DefineModuleUnder("Async", grb.DefineModule("GRuby")).Call("__define", c, grb.symbol(name))
+
+	return err
+}
+
+// futureClass returns GRuby::Future, defining it and GRuby::Async on the
+// first call.
+func (g *GRuby) futureClass() (*Class, error) {
+	if g.futureClassV != nil {
+		return g.futureClassV, nil
+	}
+
+	class := g.DefineClassUnder("Future", nil, g.DefineModule("GRuby"))
+
+	class.DefineMethod("done?", func(grb *GRuby, self Value) (Value, Value) {
+		work := grb.futureOf(self)
+		if work == nil {
+			return grb.TrueValue(), nil
+		}
+
+		select {
+		case <-work.done:
+			return grb.TrueValue(), nil
+		default:
+			return grb.FalseValue(), nil
+		}
+	}, ArgsNone())
+
+	class.DefineMethod("__result", futureResult, ArgsNone())
+
+	class.DefineClassMethod("__wait_any", func(grb *GRuby, _ Value) (Value, Value) {
+		futures, err := ToGo[Values](grb.GetArgs()[0])
+		if err != nil {
+			return nil, grb.newError(grb.Class("TypeError", nil), err.Error())
+		}
+
+		cases := make([]reflect.SelectCase, 0, len(futures))
+
+		for _, value := range futures {
+			work := grb.futureOf(value)
+			if work == nil {
+				return grb.NilValue(), nil
+			}
+
+			cases = append(cases, reflect.SelectCase{
+				Dir:  reflect.SelectRecv,
+				Chan: reflect.ValueOf(work.done),
+				Send: reflect.Value{},
+			})
+		}
+
+		if len(cases) > 0 {
+			reflect.Select(cases)
+		}
+
+		return grb.NilValue(), nil
+	}, ArgsReq(1))
+
+	if _, err := g.LoadString(asyncCode); err != nil {
+		return nil, err
+	}
+
+	g.futureClassV = class
+
+	return class, nil
+}
+
+// futureResult waits for the work of a future, the first call stores its
+// outcome in the future so the work can be forgotten.
+func futureResult(grb *GRuby, self Value) (Value, Value) {
+	if work := grb.futureOf(self); work != nil {
+		<-work.done
+
+		self.SetInstanceVariable(futureVariable, grb.NilValue())
+
+		if work.err != nil {
+			self.SetInstanceVariable(futureErrorVariable, grb.newString(work.err.Error()))
+		} else {
+			value, err := ToRuby(grb, work.value)
+			if err != nil {
+				self.SetInstanceVariable(futureErrorVariable, grb.newString(err.Error()))
+			} else {
+				self.SetInstanceVariable(futureValueVariable, value)
+			}
+		}
+	}
+
+	if message := self.GetInstanceVariable(futureErrorVariable); message.Type() != TypeNil {
+		return nil, grb.newError(grb.Class("RuntimeError", nil), message.String())
+	}
+
+	return self.GetInstanceVariable(futureValueVariable), nil
+}
+
+// futureOf returns the work of a future, nil once it is resolved.
+func (g *GRuby) futureOf(self Value) *future {
+	work, _ := g.handle(self.GetInstanceVariable(futureVariable)).(*future)
+
+	return work
+}
@@ -0,0 +1,148 @@
+package gruby_test
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestDefineAsyncMethod(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	class := grb.DefineClass("Service", nil)
+
+	err := class.DefineAsyncMethod("double", func(grb *gruby.GRuby, self gruby.Value) (func() (any, error), gruby.Value) {
+		n := gruby.MustToGo[int](grb.GetArgs()[0])
+
+		return func() (any, error) {
+			time.Sleep(100 * time.Millisecond)
+
+			if n < 0 {
+				return nil, errors.New("negative")
+			}
+
+			return n * 2, nil
+		}, nil
+	}, gruby.ArgsReq(1))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	value, err := grb.LoadString(`Service.new.double(21)`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gruby.MustToGo[int](value)).To(Equal(42))
+
+	var arrived atomic.Int32
+
+	allArrived := make(chan struct{})
+
+	// The work of each call waits for the other calls, it only returns if
+	// they run concurrently.
+	err = class.DefineAsyncMethod("gather", func(grb *gruby.GRuby, self gruby.Value) (func() (any, error), gruby.Value) {
+		n := gruby.MustToGo[int](grb.GetArgs()[0])
+
+		return func() (any, error) {
+			if arrived.Add(1) == 3 {
+				close(allArrived)
+			}
+
+			select {
+			case <-allArrived:
+				return n * 2, nil
+			case <-time.After(5 * time.Second):
+				return nil, errors.New("the calls don't overlap")
+			}
+		}, nil
+	}, gruby.ArgsReq(1))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	value, err = grb.LoadString(`
+service = Service.new
+
+GRuby::Async.run do
+  tasks = [1, 2, 3].map { |n| GRuby::Async.async { service.gather(n) } }
+  tasks.map(&:value)
+end.inspect
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("[2, 4, 6]"))
+
+	value, err = grb.LoadString(`
+GRuby::Async.run do
+  begin
+    Service.new.double(-1)
+  rescue RuntimeError => e
+    e.message
+  end
+end
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("negative"))
+
+	_, err = grb.LoadString(`GRuby::Async.async { 1 }`)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestAsync(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	grb.TopSelf().SingletonClass().DefineMethod("lookup", func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+		return gruby.Must(grb.Async(func() (any, error) {
+			return map[string]any{"name": "gruby", "tags": []string{"ruby", "go"}}, nil
+		})), nil
+	}, gruby.ArgsNone())
+
+	value, err := grb.LoadString(`
+future = lookup
+result = future.value
+[future.done?, result["name"], result["tags"], future.value == result].inspect
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`[true, "gruby", ["ruby", "go"], true]`))
+}
+
+func TestAsyncCollected(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	var collected atomic.Bool
+
+	returned := make(chan struct{})
+
+	idx := grb.ArenaSave()
+
+	_, err := grb.Async(func() (any, error) {
+		defer close(returned)
+
+		result := &[64]byte{}
+		runtime.SetFinalizer(result, func(*[64]byte) { collected.Store(true) })
+
+		return result, nil
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	<-returned
+	grb.ArenaRestore(idx)
+
+	// The future is never awaited, its result goes away with it.
+	g.Eventually(func() bool {
+		grb.FullGC()
+		runtime.GC()
+
+		return collected.Load()
+	}).Should(BeTrue())
+}
@@ -0,0 +1,188 @@
+package gruby
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var ErrInvalidAttr = errors.New("invalid attribute options")
+
+// AttrOptions configures an attribute defined with DefineAttr.
+type AttrOptions struct {
+	// Get returns the value of the attribute of an instance, it must be a
+	// func(self Value) T or a func(self Value) (T, error). The value is
+	// converted to Ruby like a Go value returned to Ruby, an error is raised
+	// as RuntimeError. Without Get, the attribute is stored in the instance
+	// variable named after it.
+	Get any
+	// Set stores the value of the attribute of an instance, it must be a
+	// func(self Value, value T) or a func(self Value, value T) error. The
+	// value is converted with Decode, the writer raises a TypeError if it
+	// can't be, and an ArgumentError with the message of the error Set
+	// returns. It is required with Get unless the attribute is read only.
+	// Without Get, the attribute is write only, like with attr_writer.
+	Set any
+	// Validate checks a value before it is stored, the writer raises an
+	// ArgumentError with the message of the error it returns. The value is
+	// of the type Set takes, or a Value if the attribute is stored in an
+	// instance variable.
+	Validate func(value any) error
+	// ReadOnly defines the reader only, it can't be combined with Set.
+	ReadOnly bool
+}
+
+// DefineAttr defines a reader and a writer for an attribute on the class,
+// like attr_accessor does, backed by an instance variable or by Go:
+//
+//	class.DefineAttr("name", gruby.AttrOptions{
+//		Get: func(self gruby.Value) string { return users[id(self)].Name },
+//		Set: func(self gruby.Value, name string) { users[id(self)].Name = name },
+//		Validate: func(value any) error {
+//			if value.(string) == "" {
+//				return errors.New("name can't be empty")
+//			}
+//			return nil
+//		},
+//	})
+//
+// Scripts use it like any attribute, user.name = "bob".
+func (c *Class) DefineAttr(name string, opts AttrOptions) error {
+	getter, setter, err := attrAccessors(name, opts)
+	if err != nil {
+		return err
+	}
+
+	if getter != nil {
+		c.DefineMethod(name, getter, ArgsNone())
+	}
+
+	if setter != nil {
+		c.DefineMethod(name+"=", setter, ArgsReq(1))
+	}
+
+	return nil
+}
+
+// attrAccessors returns the reader and the writer of an attribute, either
+// is nil if the attribute is write or read only.
+func attrAccessors(name string, opts AttrOptions) (Func, Func, error) {
+	switch {
+	case opts.ReadOnly && opts.Set != nil:
+		return nil, nil, fmt.Errorf("%w: %s is read only and has Set", ErrInvalidAttr, name)
+	case opts.Get == nil && opts.Set == nil:
+		if opts.ReadOnly {
+			return ivarGetter("@" + name), nil, nil
+		}
+
+		return ivarGetter("@" + name), ivarSetter("@"+name, opts.Validate), nil
+	case opts.Get == nil:
+		setter, err := attrSetter(name, opts.Set, opts.Validate)
+
+		return nil, setter, err
+	}
+
+	getter, err := attrGetter(name, opts.Get)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.ReadOnly {
+		return getter, nil, nil
+	}
+
+	setter, err := attrSetter(name, opts.Set, opts.Validate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return getter, setter, nil
+}
+
+func ivarGetter(variable string) Func {
+	return func(_ *GRuby, self Value) (Value, Value) {
+		return self.GetInstanceVariable(variable), nil
+	}
+}
+
+func ivarSetter(variable string, validate func(value any) error) Func {
+	return func(grb *GRuby, self Value) (Value, Value) {
+		value := grb.GetArgs()[0]
+
+		if validate != nil {
+			if err := validate(value); err != nil {
+				return nil, grb.newError(grb.Class("ArgumentError", nil), err.Error())
+			}
+		}
+
+		self.SetInstanceVariable(variable, value)
+
+		return value, nil
+	}
+}
+
+func attrGetter(name string, get any) (Func, error) {
+	fn := reflect.ValueOf(get)
+	fnType := fn.Type()
+
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 1 || fnType.In(0) != valueType ||
+		fnType.NumOut() == 0 || fnType.NumOut() > 2 || fnType.NumOut() == 2 && fnType.Out(1) != errorType {
+		return nil, fmt.Errorf("%w: Get of %s is a %s", ErrInvalidAttr, name, fnType)
+	}
+
+	return func(grb *GRuby, self Value) (Value, Value) {
+		out := fn.Call([]reflect.Value{reflect.ValueOf(self)})
+
+		if len(out) == 2 {
+			if err, _ := out[1].Interface().(error); err != nil {
+				return nil, grb.newError(grb.Class("RuntimeError", nil), err.Error())
+			}
+		}
+
+		value, err := ToRuby(grb, out[0].Interface())
+		if err != nil {
+			return nil, grb.newError(grb.Class("TypeError", nil), err.Error())
+		}
+
+		return value, nil
+	}, nil
+}
+
+func attrSetter(name string, set any, validate func(value any) error) (Func, error) {
+	if set == nil {
+		return nil, fmt.Errorf("%w: %s has Get without Set", ErrInvalidAttr, name)
+	}
+
+	fn := reflect.ValueOf(set)
+	fnType := fn.Type()
+
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 2 || fnType.In(0) != valueType ||
+		fnType.NumOut() > 1 || fnType.NumOut() == 1 && fnType.Out(0) != errorType {
+		return nil, fmt.Errorf("%w: Set of %s is a %s", ErrInvalidAttr, name, fnType)
+	}
+
+	return func(grb *GRuby, self Value) (Value, Value) {
+		arg := grb.GetArgs()[0]
+
+		value, err := decodeType(fnType.In(1), arg)
+		if err != nil {
+			return nil, grb.newError(grb.Class("TypeError", nil), err.Error())
+		}
+
+		if validate != nil {
+			if vErr := validate(value.Interface()); vErr != nil {
+				return nil, grb.newError(grb.Class("ArgumentError", nil), vErr.Error())
+			}
+		}
+
+		out := fn.Call([]reflect.Value{reflect.ValueOf(self), value})
+
+		if len(out) == 1 {
+			if sErr, _ := out[0].Interface().(error); sErr != nil {
+				return nil, grb.newError(grb.Class("ArgumentError", nil), sErr.Error())
+			}
+		}
+
+		return arg, nil
+	}, nil
+}
@@ -0,0 +1,14 @@
+# The default build config used by gruby. Set MRUBY_CONFIG to use your own,
+# it must define MRB_USE_DEBUG_HOOK as gruby is compiled with it.
+MRuby::Build.new do |conf|
+  conf.toolchain
+
+  conf.gembox 'default'
+
+  # Used by the debug package to evaluate code in the paused frame.
+  conf.gem core: 'mruby-binding'
+  conf.gem core: 'mruby-eval'
+
+  # Enables the code fetch hook used by GRuby#SetTraceHook.
+  conf.defines << 'MRB_USE_DEBUG_HOOK'
+end
@@ -0,0 +1,47 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+var ErrDumpFailed = errors.New("failed to dump bytecode")
+
+// DumpBytecode serializes a proc, usually the result of Parser.GenerateCode,
+// into the mruby bytecode format (the same .mrb format mrbc produces). Debug
+// information such as filenames and line numbers is preserved, so backtraces
+// of the loaded code match the original source.
+func (g *GRuby) DumpBytecode(proc Value) ([]byte, error) {
+	if proc.Type() != TypeProc {
+		return nil, fmt.Errorf("%w: value is not a proc", ErrDumpFailed)
+	}
+
+	var bin *C.uint8_t
+	var size C.size_t
+
+	status := C._go_mrb_dump_proc(g.state, C._go_mrb_proc_ptr(proc.CValue()), &bin, &size)
+	if status != C.MRB_DUMP_OK {
+		return nil, fmt.Errorf("%w: status %d", ErrDumpFailed, int(status))
+	}
+	defer C.mrb_free(g.state, unsafe.Pointer(bin))
+
+	return C.GoBytes(unsafe.Pointer(bin), C.int(size)), nil
+}
+
+// LoadBytecode loads bytecode produced by DumpBytecode or mrbc, executes it,
+// and returns its final value.
+func (g *GRuby) LoadBytecode(bin []byte) (Value, error) {
+	cbin := C.CBytes(bin)
+	defer C.free(cbin)
+
+	value := C._go_mrb_load_irep_buf(g.state, cbin, C.size_t(len(bin)))
+	if exc := checkException(g); exc != nil {
+		return nil, exc
+	}
+
+	return g.value(value), nil
+}
@@ -0,0 +1,76 @@
+package gruby_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestDumpBytecode(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	parser := gruby.NewParser(grb)
+	defer parser.Close()
+
+	_, err := parser.Parse(`def answer; 40 + 2; end; answer`, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bin, err := grb.DumpBytecode(parser.GenerateCode())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(bin[:4])).To(Equal("RITE"))
+
+	other := gruby.Must(gruby.New())
+	defer other.Close()
+
+	result, err := other.LoadBytecode(bin)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gruby.ToGo[int](result)).To(Equal(42))
+}
+
+func TestDumpBytecode_notProc(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	_, err := grb.DumpBytecode(gruby.MustToRuby(grb, "foo"))
+	g.Expect(err).To(MatchError(gruby.ErrDumpFailed))
+}
+
+func TestLoadBytecodeException(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	parser := gruby.NewParser(grb)
+	defer parser.Close()
+	context := gruby.NewCompileContext(grb)
+	context.SetFilename("script.rb")
+	defer context.Close()
+
+	_, err := parser.Parse(`raise "boom"`, context)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bin, err := grb.DumpBytecode(parser.GenerateCode())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = grb.LoadBytecode(bin)
+	g.Expect(err).To(HaveOccurred())
+
+	var exc *gruby.ExceptionError
+	g.Expect(errors.As(err, &exc)).To(BeTrue())
+	g.Expect(exc.Message).To(Equal("boom"))
+	g.Expect(exc.File).To(Equal("script.rb"))
+
+	_, err = grb.LoadBytecode([]byte("garbage"))
+	g.Expect(err).To(HaveOccurred())
+}
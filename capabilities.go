@@ -0,0 +1,78 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+import (
+	"slices"
+	"strings"
+)
+
+// Capabilities is a set of permissions granted to the code loaded with
+// LoadStringWith. Their names are up to the application, like "http.get" or
+// "db.read".
+type Capabilities []string
+
+// Has reports whether the capability is in the set.
+func (c Capabilities) Has(capability string) bool {
+	return slices.Contains(c, capability)
+}
+
+// LoadStringWith loads code like LoadString, granting it the capabilities.
+// Calling a method defined in Go with DefineMethod or DefineClassMethod, or a
+// proc created with NewProc or NewLambda, that requires a capability which is
+// not granted raises SecurityError. Empty or nil capabilities only allow
+// methods and procs which require none.
+//
+// The capabilities apply to everything executed until LoadStringWith returns,
+// including procs and methods defined by other code. Nested LoadStringWith
+// calls, from methods defined in Go, can't grant more than their caller has.
+func (g *GRuby) LoadStringWith(code string, capabilities Capabilities) (Value, error) {
+	previous := g.capabilities
+
+	granted := slices.Clone(capabilities)
+	if previous != nil {
+		granted = slices.DeleteFunc(granted, func(capability string) bool {
+			return !previous.Has(capability)
+		})
+	}
+
+	g.capabilities = &granted
+	defer func() { g.capabilities = previous }()
+
+	return g.LoadString(code)
+}
+
+// CurrentCapabilities returns the capabilities granted to the code being
+// executed. ok is false outside of LoadStringWith, when everything is
+// allowed. Methods defined in Go can use it for finer-grained checks.
+func (g *GRuby) CurrentCapabilities() (Capabilities, bool) {
+	if g.capabilities == nil {
+		return nil, false
+	}
+
+	return slices.Clone(*g.capabilities), true
+}
+
+// allow reports whether all the required capabilities are granted, a nil set
+// allows everything.
+func (c *Capabilities) allow(required Capabilities) bool {
+	if c == nil {
+		return true
+	}
+
+	for _, capability := range required {
+		if !c.Has(capability) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (g *GRuby) capabilityError(mid C.mrb_sym, required Capabilities) Value {
+	missing := slices.DeleteFunc(slices.Clone(required), g.capabilities.Has)
+	message := C.GoString(C._go_mrb_sym_name(g.state, mid)) + " requires the capabilities: " + strings.Join(missing, ", ")
+
+	return g.newError(securityErrorClass(g), message)
+}
@@ -0,0 +1,95 @@
+package gruby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestLoadStringWith(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	class := grb.DefineClass("HTTP", nil)
+	class.DefineClassMethod("get", testCallback, gruby.ArgsNone(), "http.get")
+	class.DefineClassMethod("delete", testCallback, gruby.ArgsNone(), "http.get", "http.delete")
+	class.DefineClassMethod("status", testCallback, gruby.ArgsNone())
+
+	value, err := grb.LoadString(`HTTP.delete`)
+	g.Expect(err).ToNot(HaveOccurred())
+	testCallbackResult(g, value)
+
+	value, err = grb.LoadStringWith(`HTTP.get`, gruby.Capabilities{"http.get"})
+	g.Expect(err).ToNot(HaveOccurred())
+	testCallbackResult(g, value)
+
+	value, err = grb.LoadStringWith(`HTTP.status`, gruby.Capabilities{})
+	g.Expect(err).ToNot(HaveOccurred())
+	testCallbackResult(g, value)
+
+	_, err = grb.LoadStringWith(`HTTP.delete`, gruby.Capabilities{"http.get"})
+	g.Expect(err).To(MatchError("delete requires the capabilities: http.delete"))
+
+	value, err = grb.LoadStringWith(`
+begin
+  HTTP.get
+rescue SecurityError => e
+  e.class.to_s
+end
+`, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("SecurityError"))
+
+	// Nested loads can't grant more than their caller has.
+	class.DefineClassMethod("escalate", func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+		capabilities, restricted := grb.CurrentCapabilities()
+		g.Expect(restricted).To(BeTrue())
+		g.Expect(capabilities).To(Equal(gruby.Capabilities{"http.get"}))
+
+		_, err := grb.LoadStringWith(`HTTP.delete`, gruby.Capabilities{"http.get", "http.delete"})
+		g.Expect(err).To(HaveOccurred())
+
+		return nil, nil
+	}, gruby.ArgsNone())
+
+	_, err = grb.LoadStringWith(`HTTP.escalate`, gruby.Capabilities{"http.get"})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, restricted := grb.CurrentCapabilities()
+	g.Expect(restricted).To(BeFalse())
+}
+
+func TestLoadStringWithProc(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	grb.SetGlobalVariable("$get", grb.NewProc(testCallback, "http.get"))
+
+	lambda, err := grb.NewLambda(func() int { return 42 }, "http.get")
+	g.Expect(err).ToNot(HaveOccurred())
+	grb.SetGlobalVariable("$lambda", lambda)
+
+	value, err := grb.LoadStringWith(`$get.call`, gruby.Capabilities{"http.get"})
+	g.Expect(err).ToNot(HaveOccurred())
+	testCallbackResult(g, value)
+
+	_, err = grb.LoadStringWith(`$get.call`, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("requires the capabilities: http.get")))
+
+	value, err = grb.LoadStringWith(`
+begin
+  $lambda.call
+rescue SecurityError => e
+  e.class.to_s
+end
+`, gruby.Capabilities{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("SecurityError"))
+}
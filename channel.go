@@ -0,0 +1,336 @@
+package gruby
+
+import (
+	"time"
+)
+
+// channelVariable holds the handle of the channel of a GRuby::Channel, it has
+// no @ so scripts can't see or change it.
+const channelVariable = "__channel"
+
+// channelCode completes GRuby::Channel, whose other methods are defined in
+// Go.
+const channelCode = `
+class GRuby::Channel
+  include Enumerable
+
+  def each
+    while (item = __next)
+      yield item[0]
+    end
+    self
+  end
+
+  def empty?
+    size == 0
+  end
+
+  class << self
+    undef_method :new
+  end
+end
+`
+
+// rubyChannel is what GRuby::Channel needs from a Go channel, whatever the
+// type of its elements.
+type rubyChannel interface {
+	push(grb *GRuby, value Value) Value
+	// pop waits for an element for up to timeout, forever if it is
+	// negative. It returns false if there is no element.
+	pop(grb *GRuby, timeout time.Duration) (Value, bool, error)
+	close()
+	closed() bool
+	size() int
+}
+
+type goChannel[T any] struct {
+	ch       chan T
+	isClosed bool
+}
+
+// NewChannelValue wraps a Go channel as a Ruby object, so scripts can consume
+// and produce the elements of a stream:
+//
+//	events := make(chan Event)
+//	queue, err := gruby.NewChannelValue(grb, events)
+//
+//	queue.each { |event| handle(event) } # until the channel is closed
+//	queue << result
+//
+// The object is a GRuby::Channel, it has a Queue-like interface:
+//
+//   - push(item), <<(item) and enq(item) send an element, blocking while
+//     the channel is full, they raise ClosedQueueError if it is closed;
+//   - pop, shift and deq receive an element, blocking until there is one,
+//     or until the timeout in seconds given with pop(timeout) or
+//     pop(timeout: seconds) expires, they return nil when the channel is
+//     closed or on timeout;
+//   - try_pop receives an element if there is one, nil otherwise;
+//   - close closes the object, not the Go channel, which the Go code owns:
+//     pushing raises ClosedQueueError then and popping returns the buffered
+//     elements without waiting, then nil;
+//   - closed? tells if the object is closed, or if the channel is, which is
+//     only known once a pop found it closed if it is closed from Go;
+//   - each yields the elements until the channel is closed, the object is
+//     Enumerable;
+//   - size, length and empty? tell about the buffered elements.
+//
+// Elements are converted with Decode when pushed, and converted to Ruby like
+// Go values returned to Ruby when popped. Blocking operations block the VM.
+// The channel is referenced by the VM until the object is garbage collected.
+func NewChannelValue[T any](grb *GRuby, ch chan T) (Value, error) {
+	class, err := grb.channelClass()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := class.New()
+	if err != nil {
+		return nil, err
+	}
+
+	value.SetInstanceVariable(channelVariable, grb.newHandle(&goChannel[T]{ch: ch, isClosed: false}))
+
+	return value, nil
+}
+
+func (c *goChannel[T]) push(grb *GRuby, value Value) (exc Value) {
+	if c.isClosed {
+		return grb.newError(closedQueueErrorClass(grb), "queue closed")
+	}
+
+	var item T
+	if v, ok := any(&item).(*Value); ok {
+		*v = value
+	} else if err := Decode(&item, value); err != nil {
+		return grb.newError(grb.Class("TypeError", nil), err.Error())
+	}
+
+	defer func() {
+		// Sending on a closed channel panics.
+		if recover() != nil {
+			c.isClosed = true
+			exc = grb.newError(closedQueueErrorClass(grb), "queue closed")
+		}
+	}()
+
+	c.ch <- item
+
+	return nil
+}
+
+func (c *goChannel[T]) pop(grb *GRuby, timeout time.Duration) (Value, bool, error) {
+	var (
+		item T
+		ok   bool
+	)
+
+	// Once closed from Ruby nothing waits for the producers.
+	if c.isClosed {
+		timeout = 0
+	}
+
+	switch {
+	case timeout < 0:
+		item, ok = <-c.ch
+	case timeout == 0:
+		select {
+		case item, ok = <-c.ch:
+		default:
+			return nil, false, nil
+		}
+	default:
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case item, ok = <-c.ch:
+		case <-timer.C:
+			return nil, false, nil
+		}
+	}
+
+	if !ok {
+		c.isClosed = true
+		return nil, false, nil
+	}
+
+	value, err := ToRuby(grb, item)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// close only closes the wrapper, closing the channel would make the Go
+// producers panic.
+func (c *goChannel[T]) close() {
+	c.isClosed = true
+}
+
+func (c *goChannel[T]) closed() bool {
+	return c.isClosed
+}
+
+func (c *goChannel[T]) size() int {
+	return len(c.ch)
+}
+
+// channelClass returns GRuby::Channel, defining it on the first call.
+func (g *GRuby) channelClass() (*Class, error) {
+	if g.channelClassV != nil {
+		return g.channelClassV, nil
+	}
+
+	class := g.DefineClassUnder("Channel", nil, g.DefineModule("GRuby"))
+	closedQueueErrorClass(g)
+
+	push := func(grb *GRuby, self Value) (Value, Value) {
+		channel, exc := grb.channelOf(self)
+		if exc != nil {
+			return nil, exc
+		}
+
+		if exc = channel.push(grb, grb.GetArgs()[0]); exc != nil {
+			return nil, exc
+		}
+
+		return self, nil
+	}
+
+	for _, name := range []string{"push", "<<", "enq"} {
+		class.DefineMethod(name, push, ArgsReq(1))
+	}
+
+	for _, name := range []string{"pop", "shift", "deq"} {
+		class.DefineMethod(name, channelPop, ArgsOpt(1))
+	}
+
+	class.DefineMethod("try_pop", func(grb *GRuby, self Value) (Value, Value) {
+		return grb.channelReceive(self, 0)
+	}, ArgsNone())
+
+	class.DefineMethod("__next", func(grb *GRuby, self Value) (Value, Value) {
+		channel, exc := grb.channelOf(self)
+		if exc != nil {
+			return nil, exc
+		}
+
+		value, ok, err := channel.pop(grb, -1)
+		if err != nil {
+			return nil, grb.newError(grb.Class("TypeError", nil), err.Error())
+		}
+
+		if !ok {
+			return grb.NilValue(), nil
+		}
+
+		return MustToRuby(grb, Values{value}), nil
+	}, ArgsNone())
+
+	class.DefineMethod("close", func(grb *GRuby, self Value) (Value, Value) {
+		channel, exc := grb.channelOf(self)
+		if exc != nil {
+			return nil, exc
+		}
+
+		channel.close()
+
+		return self, nil
+	}, ArgsNone())
+
+	class.DefineMethod("closed?", func(grb *GRuby, self Value) (Value, Value) {
+		channel, exc := grb.channelOf(self)
+		if exc != nil {
+			return nil, exc
+		}
+
+		return MustToRuby(grb, channel.closed()), nil
+	}, ArgsNone())
+
+	size := func(grb *GRuby, self Value) (Value, Value) {
+		channel, exc := grb.channelOf(self)
+		if exc != nil {
+			return nil, exc
+		}
+
+		return MustToRuby(grb, channel.size()), nil
+	}
+
+	class.DefineMethod("size", size, ArgsNone())
+	class.DefineMethod("length", size, ArgsNone())
+
+	if _, err := g.LoadString(channelCode); err != nil {
+		return nil, err
+	}
+
+	g.channelClassV = class
+
+	return class, nil
+}
+
+func channelPop(grb *GRuby, self Value) (Value, Value) {
+	timeout := time.Duration(-1)
+
+	if args := grb.GetArgs(); len(args) > 0 {
+		seconds := args[0]
+		if seconds.Type() == TypeHash {
+			hash := Hash{seconds}
+			if seconds = hash.Get(grb.symbol("timeout")); seconds == nil {
+				seconds = grb.NilValue()
+			}
+		}
+
+		switch seconds.Type() {
+		case TypeFixnum:
+			timeout = max(time.Duration(MustToGo[int](seconds))*time.Second, 0)
+		case TypeFloat:
+			timeout = max(time.Duration(MustToGo[float64](seconds)*float64(time.Second)), 0)
+		case TypeNil:
+		default:
+			return nil, grb.newError(grb.Class("TypeError", nil), "timeout must be a number")
+		}
+	}
+
+	return grb.channelReceive(self, timeout)
+}
+
+func (g *GRuby) channelReceive(self Value, timeout time.Duration) (Value, Value) {
+	channel, exc := g.channelOf(self)
+	if exc != nil {
+		return nil, exc
+	}
+
+	value, ok, err := channel.pop(g, timeout)
+	if err != nil {
+		return nil, g.newError(g.Class("TypeError", nil), err.Error())
+	}
+
+	if !ok {
+		return g.NilValue(), nil
+	}
+
+	return value, nil
+}
+
+// channelOf returns the channel of a GRuby::Channel, raising TypeError for
+// objects created without NewChannelValue, with allocate for instance.
+func (g *GRuby) channelOf(self Value) (rubyChannel, Value) {
+	channel, ok := g.handle(self.GetInstanceVariable(channelVariable)).(rubyChannel)
+	if !ok {
+		return nil, g.newError(g.Class("TypeError", nil), "uninitialized channel")
+	}
+
+	return channel, nil
+}
+
+// closedQueueErrorClass returns ClosedQueueError, defining it if the VM does
+// not.
+func closedQueueErrorClass(grb *GRuby) *Class {
+	if grb.ConstDefined("StopIteration", grb.ObjectClass()) {
+		return grb.errorClass("ClosedQueueError", "StopIteration")
+	}
+
+	return grb.errorClass("ClosedQueueError", "IndexError")
+}
@@ -0,0 +1,87 @@
+package gruby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestNewChannelValue(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	events := make(chan int, 3)
+	events <- 1
+	events <- 2
+	events <- 3
+	close(events)
+
+	type result struct {
+		Name  string
+		Count int
+	}
+
+	results := make(chan result, 2)
+
+	eventsValue, err := gruby.NewChannelValue(grb, events)
+	g.Expect(err).ToNot(HaveOccurred())
+	grb.SetGlobalVariable("$events", eventsValue)
+
+	resultsValue, err := gruby.NewChannelValue(grb, results)
+	g.Expect(err).ToNot(HaveOccurred())
+	grb.SetGlobalVariable("$results", resultsValue)
+
+	value, err := grb.LoadString(`
+doubled = $events.map { |event| event * 2 }
+$results << { "name" => "doubled", "count" => doubled.size }
+$results.push({ "name" => "closed", "count" => $events.closed? ? 1 : 0 })
+[doubled, $events.pop, $results.size].inspect
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("[[2, 4, 6], nil, 2]"))
+
+	g.Expect(<-results).To(Equal(result{Name: "doubled", Count: 3}))
+	g.Expect(<-results).To(Equal(result{Name: "closed", Count: 1}))
+
+	value, err = grb.LoadString(`[$results.try_pop, $results.pop(0.01), $results.pop(timeout: 0), $results.empty?].inspect`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("[nil, nil, nil, true]"))
+
+	results <- result{Name: "from go", Count: 1}
+
+	value, err = grb.LoadString(`$results.pop["name"]`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("from go"))
+
+	value, err = grb.LoadString(`
+$results.close
+begin
+  $results << { "name" => "late" }
+rescue ClosedQueueError
+  "closed"
+end
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("closed"))
+
+	_, err = grb.LoadString(`GRuby::Channel.new`)
+	g.Expect(err).To(HaveOccurred())
+
+	for _, code := range []string{`GRuby::Channel.allocate.pop`, `GRuby::Channel.allocate << 1`, `GRuby::Channel.allocate.size`} {
+		_, err = grb.LoadString(code)
+		g.Expect(err).To(MatchError("uninitialized channel"), code)
+	}
+
+	// Closing from Ruby leaves the channel to its Go owner.
+	results <- result{Name: "buffered", Count: 1}
+
+	value, err = grb.LoadString(`[$results.closed?, $results.pop["name"], $results.pop].inspect`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`[true, "buffered", nil]`))
+
+	g.Expect(func() { results <- result{Name: "still open", Count: 1} }).ToNot(Panic())
+}
@@ -0,0 +1,476 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+)
+
+var (
+	// ErrNoCheckpoint is returned by Reset when Checkpoint was not called.
+	ErrNoCheckpoint = errors.New("no checkpoint to reset to")
+	// ErrNotRestorable is returned by Reset when the VM was changed in a way
+	// it can't be restored from, the VM should be discarded then.
+	ErrNotRestorable = errors.New("the VM can't be restored to the checkpoint")
+)
+
+type checkpoint struct {
+	globals     map[string]Value
+	modules     map[string]moduleSnapshot
+	topIvars    map[string]bool
+	loadedFiles map[string]bool
+	// kept holds the values protected from the GC for the checkpoint.
+	kept []Value
+}
+
+// moduleSnapshot holds what is defined in a class or module.
+type moduleSnapshot struct {
+	module           Value
+	constants        map[string]bool
+	methods          map[string]bool
+	singletonMethods map[string]bool
+	classVariables   map[string]Value
+	instance         classSnapshot
+	singleton        classSnapshot
+}
+
+// classSnapshot holds the methods defined in a class itself and the links
+// to its ancestors, see _go_mrb_restore_ancestors.
+type classSnapshot struct {
+	methods     map[C.mrb_sym]C.mrb_method_t
+	origin      *C.struct_RClass
+	super       *C.struct_RClass
+	originSuper *C.struct_RClass
+}
+
+// Checkpoint records the state of the VM for Reset, usually right after New so
+// a VM can be reused, for instance from a pool, without code loaded by one
+// user leaking into the next. Calling it again replaces the checkpoint.
+func (g *GRuby) Checkpoint() error {
+	cp := &checkpoint{
+		globals:     map[string]Value{},
+		modules:     map[string]moduleSnapshot{},
+		topIvars:    nil,
+		loadedFiles: maps.Clone(g.loadedFiles),
+		kept:        nil,
+	}
+
+	if err := g.snapshot(cp); err != nil {
+		g.release(cp)
+		return err
+	}
+
+	g.discardCheckpoint()
+	g.checkpoint = cp
+
+	return nil
+}
+
+func (g *GRuby) snapshot(cp *checkpoint) error {
+	names, err := g.globalNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		cp.globals[name] = g.keep(cp, g.GetGlobalVariable(name))
+	}
+
+	if err = g.snapshotModule(cp, "Object", g.ObjectClass(), map[string]bool{}); err != nil {
+		return err
+	}
+
+	cp.topIvars, err = g.nameSet(g.TopSelf(), "instance_variables")
+
+	return err
+}
+
+// keep protects the value from the GC until the checkpoint is discarded.
+func (g *GRuby) keep(cp *checkpoint, value Value) Value {
+	C.mrb_gc_register(g.state, value.CValue())
+	cp.kept = append(cp.kept, value)
+
+	return value
+}
+
+// Reset restores the VM to the state recorded by Checkpoint: it restores the
+// values of global variables and removes the global variables, constants,
+// classes, modules and methods defined since, as well as the instance
+// variables of the top-level self. The methods, class variables and
+// ancestors of the classes and modules which existed at the checkpoint are
+// restored too, so monkey-patches are undone. The files loaded since are
+// forgotten, so they can be loaded again. Then it runs a full GC.
+//
+// Constants which existed at the checkpoint and were redefined since, as
+// well as instance variables of classes, are not restored. Modules
+// prepended to a class which had none at the checkpoint can't be removed,
+// Reset returns ErrNotRestorable then.
+func (g *GRuby) Reset() error {
+	if g.checkpoint == nil {
+		return ErrNoCheckpoint
+	}
+
+	for path, snapshot := range g.checkpoint.modules {
+		if err := g.resetModule(path, snapshot); err != nil {
+			return err
+		}
+	}
+
+	names, err := g.globalNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, ok := g.checkpoint.globals[name]; !ok {
+			g.removeGlobalVariable(name)
+		}
+	}
+
+	for name, value := range g.checkpoint.globals {
+		g.SetGlobalVariable(name, value)
+	}
+
+	if err = g.removeNew(g.TopSelf(), "instance_variables", g.checkpoint.topIvars, "remove_instance_variable"); err != nil {
+		return err
+	}
+
+	g.loadedFiles = maps.Clone(g.checkpoint.loadedFiles)
+
+	// The classes defined on demand may have been removed with GRuby, they
+	// are defined again when needed.
+	g.outputInstalled = false
+	g.channelClassV = nil
+	g.futureClassV = nil
+
+	g.FullGC()
+
+	return nil
+}
+
+func (g *GRuby) discardCheckpoint() {
+	if g.checkpoint == nil {
+		return
+	}
+
+	g.release(g.checkpoint)
+	g.checkpoint = nil
+}
+
+func (g *GRuby) release(cp *checkpoint) {
+	for _, value := range cp.kept {
+		C.mrb_gc_unregister(g.state, value.CValue())
+	}
+}
+
+// snapshotModule records the module and, recursively, the modules defined
+// under it.
+func (g *GRuby) snapshotModule(cp *checkpoint, path string, module Value, visited map[string]bool) error {
+	visited[path] = true
+
+	constants, err := g.nameSet(module, "constants", g.FalseValue())
+	if err != nil {
+		return err
+	}
+
+	methods, err := g.methodNames(module)
+	if err != nil {
+		return err
+	}
+
+	singletonMethods, err := g.nameSet(module, "singleton_methods", g.FalseValue())
+	if err != nil {
+		return err
+	}
+
+	classVariables, err := g.nameSet(module, "class_variables", g.FalseValue())
+	if err != nil {
+		return err
+	}
+
+	snapshot := moduleSnapshot{
+		module:           g.keep(cp, module),
+		constants:        constants,
+		methods:          methods,
+		singletonMethods: singletonMethods,
+		classVariables:   map[string]Value{},
+		instance:         g.snapshotClass(cp, C._go_mrb_class_ptr(module.CValue()), methods),
+		singleton:        g.snapshotClass(cp, C.mrb_singleton_class_ptr(g.state, module.CValue()), singletonMethods),
+	}
+
+	for name := range classVariables {
+		value, cErr := module.Call("class_variable_get", g.symbol(name))
+		if cErr != nil {
+			return cErr
+		}
+
+		snapshot.classVariables[name] = g.keep(cp, value)
+	}
+
+	cp.modules[path] = snapshot
+
+	for name := range constants {
+		value, cErr := module.Call("const_get", g.symbol(name))
+		if cErr != nil {
+			return cErr
+		}
+
+		if value.Type() != TypeClass && value.Type() != TypeModule {
+			continue
+		}
+
+		// Only follow modules from where they are defined, aliases and
+		// Object::Object would visit them twice.
+		childPath := qualifiedName(path, name)
+		if visited[childPath] || moduleName(value) != childPath {
+			continue
+		}
+
+		if err = g.snapshotModule(cp, childPath, value, visited); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *GRuby) resetModule(path string, snapshot moduleSnapshot) error {
+	module := Value(g.ObjectClass())
+	if path != "Object" {
+		var err error
+		if module, err = g.ObjectClass().Call("const_get", MustToRuby(g, path)); err != nil {
+			// Removed since the checkpoint, there is nothing to restore it
+			// from.
+			return ignoreNameError(err)
+		}
+	}
+
+	if err := g.removeNew(module, "constants", snapshot.constants, "remove_const", g.FalseValue()); err != nil {
+		return err
+	}
+
+	// A class defined again under the same name since, there is nothing to
+	// restore in it.
+	if !g.same(module, snapshot.module) {
+		return nil
+	}
+
+	for _, list := range []string{"instance_methods", "private_instance_methods"} {
+		if err := g.removeNew(module, list, snapshot.methods, "remove_method", g.FalseValue()); err != nil {
+			return err
+		}
+	}
+
+	if err := g.restoreClass(path, C._go_mrb_class_ptr(module.CValue()), snapshot.instance); err != nil {
+		return err
+	}
+
+	singleton, err := module.Call("singleton_class")
+	if err != nil {
+		return err
+	}
+
+	current, err := g.nameSet(module, "singleton_methods", g.FalseValue())
+	if err != nil {
+		return err
+	}
+
+	for name := range current {
+		if snapshot.singletonMethods[name] {
+			continue
+		}
+
+		if _, err = singleton.Call("remove_method", g.symbol(name)); err != nil {
+			return err
+		}
+	}
+
+	if err = g.restoreClass(path+".singleton_class", C._go_mrb_class_ptr(singleton.CValue()), snapshot.singleton); err != nil {
+		return err
+	}
+
+	return g.restoreClassVariables(module, snapshot.classVariables)
+}
+
+// snapshotClass records the methods with the given names defined in the
+// class itself, and the links to its ancestors.
+func (g *GRuby) snapshotClass(cp *checkpoint, class *C.struct_RClass, names map[string]bool) classSnapshot {
+	origin := C._go_mrb_class_origin(class)
+	snapshot := classSnapshot{
+		methods:     map[C.mrb_sym]C.mrb_method_t{},
+		origin:      origin,
+		super:       C._go_mrb_class_super(class),
+		originSuper: C._go_mrb_class_super(origin),
+	}
+
+	for name := range names {
+		cstr := C.CString(name)
+		mid := C.mrb_intern_cstr(g.state, cstr)
+		freeStr(cstr)
+
+		var method C.mrb_method_t
+		if C._go_mrb_own_method(g.state, class, mid, &method) == 0 {
+			continue
+		}
+
+		// Keep the bodies of methods defined in Ruby, and the handles of
+		// methods defined in Go, for when they are restored.
+		if proc := C._go_mrb_method_proc(method); C._go_mrb_bool2int(C._go_mrb_nil_p(proc)) == 0 {
+			g.keep(cp, g.value(proc))
+		}
+
+		snapshot.methods[mid] = method
+	}
+
+	return snapshot
+}
+
+// restoreClass puts back the methods and the ancestors recorded by
+// snapshotClass.
+func (g *GRuby) restoreClass(path string, class *C.struct_RClass, snapshot classSnapshot) error {
+	if C._go_mrb_restore_ancestors(g.state, class, snapshot.origin, snapshot.super, snapshot.originSuper) == 0 {
+		return fmt.Errorf("%w: a module was prepended to %s", ErrNotRestorable, path)
+	}
+
+	for mid, method := range snapshot.methods {
+		C._go_mrb_restore_method(g.state, class, mid, method)
+
+		if err := checkException(g); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreClassVariables removes the class variables defined since the
+// checkpoint and restores the values of the others. Unchanged ones are left
+// alone, frozen classes raise on any change.
+func (g *GRuby) restoreClassVariables(module Value, snapshot map[string]Value) error {
+	names := map[string]bool{}
+	for name := range snapshot {
+		names[name] = true
+	}
+
+	if err := g.removeNew(module, "class_variables", names, "remove_class_variable", g.FalseValue()); err != nil {
+		return err
+	}
+
+	for name, value := range snapshot {
+		current, err := module.Call("class_variable_get", g.symbol(name))
+		if err == nil && g.same(current, value) {
+			continue
+		}
+
+		if _, err = module.Call("class_variable_set", g.symbol(name), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeNew calls remove with every name returned by list which is not in
+// the snapshot.
+func (g *GRuby) removeNew(receiver Value, list string, snapshot map[string]bool, remove string, args ...Value) error {
+	current, err := g.nameSet(receiver, list, args...)
+	if err != nil {
+		return err
+	}
+
+	for name := range current {
+		if snapshot[name] {
+			continue
+		}
+
+		if _, err = receiver.Call(remove, g.symbol(name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *GRuby) methodNames(module Value) (map[string]bool, error) {
+	methods, err := g.nameSet(module, "instance_methods", g.FalseValue())
+	if err != nil {
+		return nil, err
+	}
+
+	private, err := g.nameSet(module, "private_instance_methods", g.FalseValue())
+	if err != nil {
+		return nil, err
+	}
+
+	maps.Copy(methods, private)
+
+	return methods, nil
+}
+
+// nameSet calls a method returning a list of symbols, like constants, and
+// returns their names.
+func (g *GRuby) nameSet(receiver Value, method string, args ...Value) (map[string]bool, error) {
+	list, err := receiver.Call(method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, name := range MustToGo[Values](list) {
+		names[name.String()] = true
+	}
+
+	return names, nil
+}
+
+// globalNames returns the names of the global variables. mruby keeps some
+// internal values in variables without the $ prefix, they are skipped.
+func (g *GRuby) globalNames() ([]string, error) {
+	names, err := g.nameSet(g.TopSelf(), "global_variables")
+	if err != nil {
+		return nil, err
+	}
+
+	globals := make([]string, 0, len(names))
+	for name := range names {
+		if strings.HasPrefix(name, "$") {
+			globals = append(globals, name)
+		}
+	}
+
+	return globals, nil
+}
+
+func (g *GRuby) removeGlobalVariable(name string) {
+	cstr := C.CString(name)
+	defer freeStr(cstr)
+
+	C.mrb_gv_remove(g.state, C.mrb_intern_cstr(g.state, cstr))
+}
+
+// same reports whether a and b are the same object.
+func (g *GRuby) same(a, b Value) bool {
+	return C._go_mrb_bool2int(C.mrb_obj_eq(g.state, a.CValue(), b.CValue())) != 0
+}
+
+// moduleName returns the name of a class or module, empty for anonymous ones.
+func moduleName(module Value) string {
+	name, err := module.Call("name")
+	if err != nil || name.Type() != TypeString {
+		return ""
+	}
+
+	return name.String()
+}
+
+func qualifiedName(path string, name string) string {
+	if path == "Object" {
+		return name
+	}
+
+	return path + "::" + name
+}
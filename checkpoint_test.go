@@ -0,0 +1,149 @@
+package gruby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestGRuby_Reset(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	g.Expect(grb.Reset()).To(MatchError(gruby.ErrNoCheckpoint))
+
+	_, err := grb.LoadString(`$counter = 1; module Base; end`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(grb.Checkpoint()).To(Succeed())
+
+	_, _, err = grb.LoadFile("user.rb", `
+$counter = 2
+$user = "alice"
+@name = "alice"
+LIMIT = 10
+
+class User; end
+module Base; class Nested; end; end
+
+def helper; end
+class String; def shout; upcase; end; end
+def Base.build; end
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(grb.Reset()).To(Succeed())
+
+	g.Expect(gruby.MustToGo[int](grb.GetGlobalVariable("$counter"))).To(Equal(1))
+
+	value, err := grb.LoadString(`[
+  global_variables.include?(:$user),
+  instance_variables,
+  Object.const_defined?(:LIMIT),
+  Object.const_defined?(:User),
+  Object.const_defined?(:Base),
+  Base.constants,
+  respond_to?(:helper, true),
+  "a".respond_to?(:shout),
+  Base.respond_to?(:build),
+].inspect`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`[false, [], false, false, true, [], false, false, false]`))
+
+	// Loaded files are forgotten, so they can be loaded again.
+	loaded, _, err := grb.LoadFile("user.rb", `LIMIT = 20`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(loaded).To(BeTrue())
+}
+
+func TestGRuby_ResetDefinedOnDemand(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	g.Expect(grb.Checkpoint()).To(Succeed())
+
+	for range 2 {
+		events := make(chan int, 1)
+		events <- 21
+
+		value, err := gruby.NewChannelValue(grb, events)
+		g.Expect(err).ToNot(HaveOccurred())
+		grb.SetGlobalVariable("$events", value)
+
+		result, err := grb.LoadString(`$events.pop * 2`)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(gruby.MustToGo[int](result)).To(Equal(42))
+
+		g.Expect(grb.Reset()).To(Succeed())
+
+		defined, err := grb.LoadString(`Object.const_defined?(:GRuby)`)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(defined.String()).To(Equal("false"))
+	}
+}
+
+func TestGRuby_ResetMonkeyPatches(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	_, err := grb.LoadString(`
+class Config
+  @@level = 1
+
+  def self.level; @@level; end
+  def name; "config"; end
+end
+
+$ancestors = String.ancestors.size
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(grb.Checkpoint()).To(Succeed())
+
+	_, err = grb.LoadString(`
+module Loud; def loud?; true; end; end
+
+class String
+  include Loud
+  def upcase; "patched"; end
+  remove_method :downcase
+end
+
+class Config
+  @@level = 2
+  @@debug = true
+
+  def self.level; 0; end
+  def name; "patched"; end
+end
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(grb.Reset()).To(Succeed())
+
+	value, err := grb.LoadString(`[
+  "a".upcase,
+  "a".respond_to?(:loud?),
+  String.ancestors.size == $ancestors,
+  "A".downcase,
+  Config.level,
+  Config.new.name,
+  Config.class_variable_defined?(:@@debug),
+].inspect`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["A", false, true, "a", 1, "config", false]`))
+
+	_, err = grb.LoadString(`class Config; prepend(Module.new); end`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(grb.Reset()).To(MatchError(gruby.ErrNotRestorable))
+}
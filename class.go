@@ -17,19 +17,13 @@ func (c *Class) String() string {
 	return MustToGo[string](c)
 }
 
-// DefineClassMethod defines a class-level method on the given class.
-func (c *Class) DefineClassMethod(name string, cb Func, spec ArgSpec) {
-	c.GRuby().insertClassMethod(c.class.c, name, cb)
-
-	cstr := C.CString(name)
-	defer freeStr(cstr)
+// DefineClassMethod defines a class-level method on the given class. Calling
+// it requires the given capabilities, see LoadStringWith.
+func (c *Class) DefineClassMethod(name string, cb Func, spec ArgSpec, capabilities ...string) {
+	grb := c.GRuby()
+	method := goMethod{fn: cb, methodType: MethodTypeClass, spec: spec, capabilities: capabilities}
 
-	C.mrb_define_class_method(
-		c.GRuby().state,
-		c.class,
-		cstr,
-		C._go_grb_class_method_call_t(),
-		C.mrb_aspec(spec))
+	grb.defineGoMethod(C.mrb_singleton_class_ptr(grb.state, c.CValue()), name, method)
 }
 
 // DefineConst defines a constant within this class.
@@ -40,20 +34,127 @@ func (c *Class) DefineConst(name string, value Value) {
 	C.mrb_define_const(c.GRuby().state, c.class, cstr, value.CValue())
 }
 
-// DefineMethod defines an instance method on the class.
-func (c *Class) DefineMethod(name string, cb Func, spec ArgSpec) {
+// DefineMethod defines an instance method on the class. Calling it requires
+// the given capabilities, see LoadStringWith.
+func (c *Class) DefineMethod(name string, cb Func, spec ArgSpec, capabilities ...string) {
+	method := goMethod{fn: cb, methodType: MethodTypeInstance, spec: spec, capabilities: capabilities}
+
+	c.GRuby().defineGoMethod(c.class, name, method)
+}
+
+// DefineModuleFunction defines a module function, a method callable on the
+// module itself and by the classes including it, like module_function does
+// in Ruby. Calling it requires the given capabilities, see LoadStringWith.
+func (c *Class) DefineModuleFunction(name string, cb Func, spec ArgSpec, capabilities ...string) {
 	grb := c.GRuby()
-	grb.insertInstanceMethod(c.class, name, cb)
+	method := goMethod{fn: cb, methodType: MethodTypeInstance, spec: spec, capabilities: capabilities}
+
+	grb.defineGoMethod(c.class, name, method)
+	grb.defineGoMethod(C.mrb_singleton_class_ptr(grb.state, c.CValue()), name, method)
+}
+
+// Include includes the module in the class, like include does in Ruby.
+func (c *Class) Include(module *Class) error {
+	C._go_mrb_include_module(c.GRuby().state, c.class, module.class)
+
+	return checkException(c.GRuby())
+}
+
+// Prepend prepends the module to the class, like prepend does in Ruby.
+func (c *Class) Prepend(module *Class) error {
+	C._go_mrb_prepend_module(c.GRuby().state, c.class, module.class)
+
+	return checkException(c.GRuby())
+}
+
+// Extend adds the methods of the module to the class itself, like extend
+// does in Ruby.
+func (c *Class) Extend(module *Class) error {
+	return module.ExtendObject(c)
+}
+
+// ExtendObject adds the methods of the module, the receiver, to the given
+// value, like obj.extend(module) does in Ruby.
+func (c *Class) ExtendObject(value Value) error {
+	C._go_mrb_extend_object(c.GRuby().state, value.CValue(), c.class)
 
+	return checkException(c.GRuby())
+}
+
+// AliasMethod makes name another name for the old method, like
+// alias_method does in Ruby.
+func (c *Class) AliasMethod(name string, old string) error {
+	cname := C.CString(name)
+	defer freeStr(cname)
+
+	cold := C.CString(old)
+	defer freeStr(cold)
+
+	C._go_mrb_define_alias(c.GRuby().state, c.class, cname, cold)
+
+	return checkException(c.GRuby())
+}
+
+// UndefMethod prevents instances of the class from responding to the
+// method, even if an ancestor defines it, like undef_method does in Ruby.
+func (c *Class) UndefMethod(name string) error {
+	cstr := C.CString(name)
+	defer freeStr(cstr)
+
+	C._go_mrb_undef_method(c.GRuby().state, c.class, cstr)
+
+	return checkException(c.GRuby())
+}
+
+// RemoveMethod removes the method from the class, the method of an ancestor
+// is called instead if it has one, like remove_method does in Ruby.
+func (c *Class) RemoveMethod(name string) error {
 	cstr := C.CString(name)
 	defer freeStr(cstr)
 
-	C.mrb_define_method(
-		grb.state,
-		c.class,
-		cstr,
-		C._go_grb_instance_method_call_t(),
-		C.mrb_aspec(spec))
+	C._go_mrb_remove_method(c.GRuby().state, c.class, cstr)
+
+	return checkException(c.GRuby())
+}
+
+// MethodMissingFunc handles calls to undefined methods, see
+// DefineMethodMissing. name is the name of the called method, args its
+// arguments, followed by its block if it is given one.
+type MethodMissingFunc func(grb *GRuby, self Value, name string, args Values) (Value, Value)
+
+// RespondToMissingFunc tells if an instance handles calls to the given
+// undefined method, see DefineMethodMissing.
+type RespondToMissingFunc func(grb *GRuby, self Value, name string) bool
+
+// DefineMethodMissing makes fn handle the calls to undefined methods on
+// instances of the class, like defining method_missing in Ruby. It lets Go
+// build dynamic objects like proxies to maps or RPC stubs:
+//
+//	class.DefineMethodMissing(func(grb *gruby.GRuby, self gruby.Value, name string, args gruby.Values) (gruby.Value, gruby.Value) {
+//		return gruby.MustToRuby(grb, config[name]), nil
+//	}, func(grb *gruby.GRuby, self gruby.Value, name string) bool {
+//		_, ok := config[name]
+//		return ok
+//	})
+//
+// If respondTo isn't nil, respond_to_missing? is defined as well, so
+// respond_to? and method know about the methods fn handles. Otherwise
+// respond_to? is false for them, like for a Ruby method_missing without
+// respond_to_missing?.
+func (c *Class) DefineMethodMissing(fn MethodMissingFunc, respondTo RespondToMissingFunc) {
+	c.DefineMethod("method_missing", func(grb *GRuby, self Value) (Value, Value) {
+		args := grb.GetArgs()
+
+		return fn(grb, self, args[0].String(), args[1:])
+	}, ArgsReq(1)|ArgsAny())
+
+	if respondTo == nil {
+		return
+	}
+
+	c.DefineMethod("respond_to_missing?", func(grb *GRuby, self Value) (Value, Value) {
+		return MustToRuby(grb, respondTo(grb, self, grb.GetArgs()[0].String())), nil
+	}, ArgsReq(1)|ArgsOpt(1))
 }
 
 // New instantiates the class with the given args.
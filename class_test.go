@@ -1,6 +1,7 @@
 package gruby_test
 
 import (
+	"errors"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -27,6 +28,85 @@ func TestClassDefineClassMethod(t *testing.T) {
 	testCallbackResult(g, value)
 }
 
+func TestClassDefineAttr(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	type user struct {
+		name string
+		age  int
+	}
+
+	current := &user{name: "alice", age: 30}
+
+	class := grb.DefineClass("User", nil)
+
+	err := class.DefineAttr("name", gruby.AttrOptions{
+		Get: func(self gruby.Value) string { return current.name },
+		Set: func(self gruby.Value, name string) { current.name = name },
+		Validate: func(value any) error {
+			if value == "" {
+				return errors.New("name can't be empty")
+			}
+
+			return nil
+		},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	err = class.DefineAttr("age", gruby.AttrOptions{
+		Get:      func(self gruby.Value) int { return current.age },
+		ReadOnly: true,
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(class.DefineAttr("nickname", gruby.AttrOptions{})).To(Succeed())
+
+	var password string
+
+	err = class.DefineAttr("password", gruby.AttrOptions{
+		Set: func(self gruby.Value, value string) { password = value },
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	err = class.DefineAttr("broken", gruby.AttrOptions{Get: func() int { return 0 }})
+	g.Expect(err).To(MatchError(gruby.ErrInvalidAttr))
+
+	err = class.DefineAttr("frozen", gruby.AttrOptions{
+		Set:      func(self gruby.Value, value string) {},
+		ReadOnly: true,
+	})
+	g.Expect(err).To(MatchError(gruby.ErrInvalidAttr))
+
+	value, err := grb.LoadString(`
+u = User.new
+u.name = "bob"
+u.nickname = "b"
+u.password = "secret"
+[u.name, u.age, u.nickname, u.respond_to?(:age=), u.respond_to?(:password), u.respond_to?(:frozen=)].inspect
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["bob", 30, "b", false, false, false]`))
+	g.Expect(current.name).To(Equal("bob"))
+	g.Expect(password).To(Equal("secret"))
+
+	_, err = grb.LoadString(`User.new.name = ""`)
+	g.Expect(err).To(MatchError("name can't be empty"))
+
+	value, err = grb.LoadString(`
+begin
+  User.new.name = [1]
+rescue TypeError
+  "TypeError"
+end
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("TypeError"))
+}
+
 func TestClassDefineConst(t *testing.T) {
 	t.Parallel()
 	g := NewG(t)
@@ -62,6 +142,162 @@ func TestClassDefineMethod(t *testing.T) {
 	testCallbackResult(g, value)
 }
 
+func TestClassDefineMethodArgs(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	class := grb.DefineClass("Hello", nil)
+	class.DefineMethod("one", testCallback, gruby.ArgsReq(1))
+	class.DefineMethod("range", testCallback, gruby.ArgsReq(1)|gruby.ArgsOpt(2))
+	class.DefineMethod("many", testCallback, gruby.ArgsReq(2)|gruby.ArgsAny())
+	class.DefineMethod("block", testCallback, gruby.ArgsBlock())
+	class.DefineMethodMissing(func(grb *gruby.GRuby, self gruby.Value, name string, args gruby.Values) (gruby.Value, gruby.Value) {
+		return gruby.MustToRuby(grb, name), nil
+	}, nil)
+
+	for _, code := range []string{
+		`Hello.new.one(1)`,
+		`Hello.new.one(a: 1)`,
+		`Hello.new.range(1)`,
+		`Hello.new.range(1, 2, 3)`,
+		`Hello.new.many(1, 2, 3, 4)`,
+		`Hello.new.block { }`,
+	} {
+		value, err := grb.LoadString(code)
+		g.Expect(err).ToNot(HaveOccurred(), code)
+		testCallbackResult(g, value)
+	}
+
+	for code, expected := range map[string]string{
+		`Hello.new.one`:                   "wrong number of arguments (given 0, expected 1)",
+		`Hello.new.one(1, 2) { }`:         "wrong number of arguments (given 2, expected 1)",
+		`Hello.new.range(1, 2, 3, 4)`:     "wrong number of arguments (given 4, expected 1..3)",
+		`Hello.new.many(1)`:               "wrong number of arguments (given 1, expected 2+)",
+		`Hello.new.block(1) { }`:          "wrong number of arguments (given 1, expected 0)",
+		`Hello.new.send(:method_missing)`: "wrong number of arguments (given 0, expected 1+)",
+	} {
+		_, err := grb.LoadString(code)
+		g.Expect(err).To(MatchError(expected), code)
+	}
+}
+
+func TestClassDefineMethodMissing(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	config := map[string]string{"host": "localhost", "port": "5432"}
+
+	class := grb.DefineClass("Config", nil)
+	class.DefineMethodMissing(func(grb *gruby.GRuby, self gruby.Value, name string, args gruby.Values) (gruby.Value, gruby.Value) {
+		value, ok := config[name]
+		if !ok {
+			return nil, gruby.Must(grb.Class("NoMethodError", nil).New(gruby.MustToRuby(grb, "no setting "+name)))
+		}
+
+		if len(args) > 0 {
+			value += gruby.MustToGo[string](args[0])
+		}
+
+		return gruby.MustToRuby(grb, value), nil
+	}, func(grb *gruby.GRuby, self gruby.Value, name string) bool {
+		_, ok := config[name]
+		return ok
+	})
+
+	value, err := grb.LoadString(`
+config = Config.new
+[config.host, config.port(":tcp"), config.respond_to?(:host), config.respond_to?(:user)].inspect
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["localhost", "5432:tcp", true, false]`))
+
+	_, err = grb.LoadString(`Config.new.user`)
+	g.Expect(err).To(MatchError("no setting user"))
+
+	proxy := grb.DefineClass("Proxy", nil)
+	proxy.DefineMethodMissing(func(grb *gruby.GRuby, self gruby.Value, name string, args gruby.Values) (gruby.Value, gruby.Value) {
+		return gruby.MustToRuby(grb, name), nil
+	}, nil)
+
+	value, err = grb.LoadString(`[Proxy.new.anything, Proxy.new.respond_to?(:anything)].inspect`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["anything", false]`))
+}
+
+func TestClassMixins(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	greeting := grb.DefineModule("Greeting")
+	greeting.DefineMethod("greet", func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+		return gruby.MustToRuby(grb, "hello from "+self.Class().String()), nil
+	}, gruby.ArgsNone())
+	greeting.DefineModuleFunction("version", func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+		return gruby.MustToRuby(grb, 2), nil
+	}, gruby.ArgsNone())
+
+	loud := grb.DefineModule("Loud")
+	loud.DefineMethod("greet", func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+		return gruby.MustToRuby(grb, "HELLO"), nil
+	}, gruby.ArgsNone())
+
+	person := grb.DefineClass("Person", nil)
+	g.Expect(person.Include(greeting)).To(Succeed())
+	g.Expect(person.AliasMethod("hi", "greet")).To(Succeed())
+	g.Expect(person.Extend(loud)).To(Succeed())
+
+	robot := grb.DefineClass("Robot", person)
+	g.Expect(robot.Prepend(loud)).To(Succeed())
+
+	value, err := grb.LoadString(`
+[Person.new.greet, Person.new.hi, Person.greet, Robot.new.greet, Greeting.version, Robot.ancestors.first(3)].inspect
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["hello from Person", "hello from Person", "HELLO", "HELLO", 2, [Loud, Robot, Person]]`))
+
+	object, err := grb.LoadString(`Object.new`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(loud.ExtendObject(object)).To(Succeed())
+
+	value, err = object.Call("greet")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("HELLO"))
+
+	g.Expect(person.UndefMethod("hi")).To(Succeed())
+	g.Expect(robot.RemoveMethod("greet")).ToNot(Succeed())
+
+	value, err = grb.LoadString(`Person.new.respond_to?(:hi)`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("false"))
+
+	g.Expect(person.AliasMethod("hey", "unknown")).ToNot(Succeed())
+	g.Expect(greeting.Include(greeting)).ToNot(Succeed())
+
+	value, err = grb.LoadString(`
+class Person
+  alias_method :hello, :greet
+  alias salute greet
+end
+
+class << Greeting
+  alias_method :release, :version
+end
+
+[Person.new.hello, Person.new.salute, Robot.new.salute, Greeting.release].inspect
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["hello from Person", "hello from Person", "hello from Robot", 2]`))
+}
+
 func TestClassNew(t *testing.T) {
 	t.Parallel()
 	g := NewG(t)
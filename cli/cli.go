@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/zhulik/gruby"
+)
+
+// stringsFlag collects every occurrence of a repeatable flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type options struct {
+	exprs       stringsFlag
+	loadPaths   stringsFlag
+	requires    stringsFlag
+	plugins     stringsFlag
+	listPlugins bool
+	compile     string
+	dap         string
+}
+
+// Main runs the gruby command with the process arguments and returns its exit
+// status. Custom commands can register their bindings with
+// gruby.RegisterPlugin and call Main from their main package:
+//
+//	import (
+//	    _ "example.com/bindings"
+//	    "github.com/zhulik/gruby/cli"
+//	)
+//
+//	func main() {
+//	    os.Exit(cli.Main())
+//	}
+func Main() int {
+	return run(os.Args[0], os.Args[1:])
+}
+
+func run(name string, arguments []string) int {
+	var opts options
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Var(&opts.exprs, "e", "execute the given code, may be repeated")
+	flags.Var(&opts.loadPaths, "I", "add the directory to $LOAD_PATH, may be repeated")
+	flags.Var(&opts.requires, "r", "require the library before executing the script, may be repeated")
+	flags.Var(&opts.plugins, "plugin", "enable the registered plugin, may be repeated")
+	flags.BoolVar(&opts.listPlugins, "list-plugins", false, "list the registered plugins and exit")
+	flags.StringVar(&opts.compile, "compile", "", "compile the script into the given .mrb file instead of running it")
+	flags.StringVar(&opts.dap, "dap", "", "serve the Debug Adapter Protocol on the address (host:port, :port for loopback only, or stdio) instead of running a script, "+
+		"clients are not authenticated and can run any code so never expose it to untrusted hosts")
+	flags.Usage = func() { usage(flags) }
+
+	if err := flags.Parse(arguments); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+
+		return 2 //nolint:mnd
+	}
+
+	if opts.listPlugins {
+		for _, plugin := range gruby.Plugins() {
+			fmt.Fprintln(os.Stdout, plugin)
+		}
+
+		return 0
+	}
+
+	if opts.dap != "" {
+		return serveDAP(opts)
+	}
+
+	src, args, err := readScript(opts.exprs, flags.Args())
+	if err != nil {
+		return reportError(err)
+	}
+
+	if src == nil {
+		if opts.compile != "" {
+			return reportError(errNoScript)
+		}
+
+		return runREPL(opts)
+	}
+
+	grb, err := newVM(opts)
+	if err != nil {
+		return reportError(err)
+	}
+	defer grb.Close()
+
+	if pErr := preload(grb, opts); pErr != nil {
+		return reportError(pErr)
+	}
+
+	if opts.compile != "" {
+		return compileScript(grb, src, opts.compile)
+	}
+
+	return runScript(grb, src, args)
+}
+
+func runREPL(opts options) int {
+	newSessionVM := func() (*gruby.GRuby, error) {
+		grb, err := newVM(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		// A failing -r should not prevent the REPL from starting.
+		if pErr := preload(grb, opts); pErr != nil {
+			reportError(pErr)
+		}
+
+		return grb, nil
+	}
+
+	workDir := gruby.Must(os.Getwd())
+
+	repl, err := newREPL(newSessionVM, path.Join(workDir, "main.rb"))
+	if err != nil {
+		return reportError(err)
+	}
+	defer repl.Close()
+
+	if rErr := repl.Run(); rErr != nil {
+		return reportError(rErr)
+	}
+
+	return 0
+}
+
+// newVM creates a VM with the enabled plugins, `require` and the -I load paths
+// set up.
+func newVM(opts options) (*gruby.GRuby, error) {
+	mutators, err := gruby.PluginMutators(opts.plugins...)
+	if err != nil {
+		return nil, err
+	}
+
+	grb, err := gruby.New(mutators...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize VM: %w", err)
+	}
+
+	installLoader(grb, opts.loadPaths)
+
+	return grb, nil
+}
+
+// preload requires the features given with -r.
+func preload(grb *gruby.GRuby, opts options) error {
+	for _, feature := range opts.requires {
+		if err := requireFeature(grb, feature); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func usage(flags *flag.FlagSet) {
+	out := flags.Output()
+
+	fmt.Fprintf(out, "Usage: %s [options] [script.rb | script.mrb | -] [args...]\n\n", flags.Name())
+	fmt.Fprintln(out, "Without a script, runs the script from stdin if it is not a terminal, or starts a REPL.")
+	fmt.Fprintln(out, "\nOptions:")
+	flags.PrintDefaults()
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zhulik/gruby"
+)
+
+const commandsHelp = `Commands:
+  :gc              run a full GC and report the number of live objects
+  :load file.rb    load a file, files are loaded only once
+  :methods obj     list the methods of the object
+  :ancestors Klass list the ancestors of the class or module
+  :time expr       evaluate the expression, report its duration and the change
+                   in live objects
+  :reset           replace the VM with a fresh one
+  :bt              print the backtrace of the last exception
+  :help            print this message`
+
+var (
+	errMissingArgument = errors.New("missing argument")
+	errNoException     = errors.New("no exception was raised yet")
+)
+
+// runCommand executes the line if it is a REPL command and reports whether it
+// was one. Unknown commands are not handled, so symbols like `:foo` are still
+// evaluated as Ruby code.
+func (r *repl) runCommand(line string) bool {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+
+	var err error
+
+	switch name {
+	case ":gc":
+		r.cmdGC()
+	case ":load":
+		err = r.cmdLoad(arg)
+	case ":methods":
+		err = r.cmdMethods(arg)
+	case ":ancestors":
+		err = r.cmdAncestors(arg)
+	case ":time":
+		err = r.cmdTime(arg)
+	case ":reset":
+		err = r.cmdReset()
+	case ":bt":
+		err = r.cmdBacktrace()
+	case ":help":
+		fmt.Fprintln(r.out, commandsHelp)
+	default:
+		return false
+	}
+
+	if err != nil {
+		r.report(err)
+	}
+
+	return true
+}
+
+func (r *repl) cmdGC() {
+	before := r.grb.LiveObjectCount()
+	r.grb.FullGC()
+	after := r.grb.LiveObjectCount()
+
+	fmt.Fprintf(r.out, "live objects: %d -> %d (%d freed)\n", before, after, before-after)
+}
+
+func (r *repl) cmdLoad(path string) error {
+	if path == "" {
+		return fmt.Errorf("%w: :load file.rb", errMissingArgument)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	loaded, err := loadFile(r.grb, absPath)
+	if err != nil {
+		return err
+	}
+
+	if !loaded {
+		fmt.Fprintf(r.out, "%s is already loaded\n", absPath)
+		return nil
+	}
+
+	fmt.Fprintf(r.out, "loaded %s\n", absPath)
+
+	return nil
+}
+
+func (r *repl) cmdMethods(expr string) error {
+	if expr == "" {
+		return fmt.Errorf("%w: :methods obj", errMissingArgument)
+	}
+
+	defer r.grb.ArenaRestore(r.grb.ArenaSave())
+
+	methods, err := r.evalQuietly("(" + expr + ").methods")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(r.out, strings.Join(sortedStrings(methods), " "))
+
+	return nil
+}
+
+func (r *repl) cmdAncestors(expr string) error {
+	if expr == "" {
+		return fmt.Errorf("%w: :ancestors Klass", errMissingArgument)
+	}
+
+	defer r.grb.ArenaRestore(r.grb.ArenaSave())
+
+	ancestors, err := r.evalQuietly("(" + expr + ").ancestors")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(r.out, "=> %s\n", inspect(ancestors))
+
+	return nil
+}
+
+// cmdTime evaluates the expression and reports how long it took and the net
+// change in live objects, which is not the number of allocations: objects
+// freed by a GC during the evaluation are subtracted, so it can be negative.
+func (r *repl) cmdTime(expr string) error {
+	if expr == "" {
+		return fmt.Errorf("%w: :time expr", errMissingArgument)
+	}
+
+	proc, err := r.parse(expr)
+	if err != nil {
+		return err
+	}
+
+	before := r.grb.LiveObjectCount()
+	start := time.Now()
+
+	r.eval(proc)
+
+	elapsed := time.Since(start)
+	after := r.grb.LiveObjectCount()
+
+	fmt.Fprintf(r.out, "time: %s, live objects Δ: %+d\n", elapsed, after-before)
+
+	return nil
+}
+
+func (r *repl) cmdReset() error {
+	if err := r.reset(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(r.out, "VM reset")
+
+	return nil
+}
+
+func (r *repl) cmdBacktrace() error {
+	if r.lastErr == nil {
+		return errNoException
+	}
+
+	fmt.Fprintln(r.out, r.lastErr.Message)
+	for _, line := range r.lastErr.Backtrace {
+		fmt.Fprintf(r.out, "\tfrom %s\n", line)
+	}
+
+	return nil
+}
+
+// sortedStrings converts an array value to a sorted list of strings. Anything
+// but an array results in an empty list.
+func sortedStrings(value gruby.Value) []string {
+	if value.Type() != gruby.TypeArray {
+		return nil
+	}
+
+	values := gruby.MustToGo[gruby.Values](value)
+
+	list := make([]string, len(values))
+	for i, item := range values {
+		list[i] = item.String()
+	}
+
+	sort.Strings(list)
+
+	return list
+}
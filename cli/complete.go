@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// completableReceiver matches receivers that may be safe to evaluate while
+// completing: variables, constants (optionally namespaced) and integers.
+// Anything else could have side effects, so it is never evaluated. A bare
+// identifier may be a method call as well, it is only evaluated if it is a
+// local variable.
+var completableReceiver = regexp.MustCompile(`^(?:(?:\$|@{1,2})?[A-Za-z_]\w*(?:::[A-Z]\w*)*|\d+)$`) //nolint:gochecknoglobals
+
+// Do implements readline.AutoCompleter. Completions are looked up in the live
+// VM: methods of the receiver before a dot, constants, global, instance and
+// local variables, and methods of the top-level self.
+func (r *repl) Do(line []rune, pos int) ([][]rune, int) {
+	start := pos
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+
+	word := string(line[start:pos])
+
+	prefix, candidates := r.completionCandidates(word)
+
+	var completions [][]rune
+	seen := map[string]bool{}
+
+	for _, candidate := range candidates {
+		if seen[candidate] || !strings.HasPrefix(candidate, prefix) {
+			continue
+		}
+		seen[candidate] = true
+
+		completions = append(completions, []rune(candidate[len(prefix):]))
+	}
+
+	return completions, len([]rune(prefix))
+}
+
+func (r *repl) completionCandidates(word string) (string, []string) {
+	if idx := strings.LastIndex(word, "."); idx >= 0 {
+		return word[idx+1:], r.receiverList(word[:idx], "methods")
+	}
+
+	if idx := strings.LastIndex(word, "::"); idx >= 0 {
+		receiver := word[:idx]
+		return word[idx+2:], append(r.receiverList(receiver, "constants"), r.receiverList(receiver, "methods")...)
+	}
+
+	switch {
+	case strings.HasPrefix(word, "$"):
+		return word, r.evalList("global_variables")
+	case strings.HasPrefix(word, "@"):
+		return word, r.evalList("instance_variables")
+	case word != "" && unicode.IsUpper([]rune(word)[0]):
+		return word, r.evalList("Object.constants")
+	}
+
+	candidates := r.evalList("local_variables")
+	candidates = append(candidates, r.evalList("methods")...)
+	candidates = append(candidates, r.evalList("private_methods")...)
+
+	return word, candidates
+}
+
+func (r *repl) receiverList(receiver string, method string) []string {
+	if !completableReceiver.MatchString(receiver) {
+		return nil
+	}
+
+	if name := strings.SplitN(receiver, "::", 2)[0]; isBareIdentifier(name) &&
+		!slices.Contains(r.evalList("local_variables"), name) {
+		return nil
+	}
+
+	return r.evalList("(" + receiver + ")." + method)
+}
+
+// evalList evaluates code in the session scope and converts the resulting
+// array to a sorted list of strings. Any error results in an empty list, as
+// completion must never disturb the session.
+func (r *repl) evalList(code string) []string {
+	defer r.grb.ArenaRestore(r.grb.ArenaSave())
+
+	result, err := r.evalQuietly(code)
+	if err != nil {
+		return nil
+	}
+
+	return sortedStrings(result)
+}
+
+func isBareIdentifier(name string) bool {
+	first := []rune(name)[0]
+
+	return first == '_' || unicode.IsLower(first)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_$@.:?!", r)
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"io"
+	"os"
+
+	"github.com/zhulik/gruby"
+	"github.com/zhulik/gruby/debug"
+)
+
+const dapStdio = "stdio"
+
+// serveDAP serves debug sessions for editors, every session runs its program
+// in a new VM set up like the one running scripts.
+func serveDAP(opts options) int {
+	newSessionVM := func() (*gruby.GRuby, error) {
+		grb, err := newVM(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if pErr := preload(grb, opts); pErr != nil {
+			grb.Close()
+			return nil, pErr
+		}
+
+		return grb, nil
+	}
+
+	server := debug.NewServer(newSessionVM, runDebuggedScript)
+
+	var err error
+
+	// Output of the program to stdout would corrupt the protocol messages,
+	// prefer a TCP address for programs which print.
+	if opts.dap == dapStdio {
+		err = server.Serve(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout})
+	} else {
+		err = server.ListenAndServe(opts.dap)
+	}
+
+	if err != nil {
+		return reportError(err)
+	}
+
+	return 0
+}
+
+func runDebuggedScript(grb *gruby.GRuby, program string, args []string) error {
+	src, args, err := readScript(nil, append([]string{program}, args...))
+	if err != nil {
+		return err
+	}
+
+	return execScript(grb, src, args)
+}
@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/k0kubun/pp"
+	"github.com/zhulik/gruby"
+)
+
+const (
+	prompt             = ">> "
+	continuationPrompt = ".. "
+
+	historyFileName    = ".gruby_history"
+	defaultHistorySize = 1000
+)
+
+var errIncompleteInput = errors.New("incomplete input")
+
+// incompleteInputMessages are fragments of the parser errors mruby reports when
+// the input ends before a def/class/do block, a string or a heredoc is closed.
+var incompleteInputMessages = []string{ //nolint:gochecknoglobals
+	"unexpected end of file",
+	"unexpected $end",
+	"meets end of file",
+	"can't find heredoc delimiter",
+}
+
+// vmFactory creates the VMs used by the REPL, a new one is created on :reset.
+type vmFactory func() (*gruby.GRuby, error)
+
+// repl is an interactive Ruby session. Code is compiled with a shared
+// CompileContext and executed with RunWithContext, so local variables survive
+// between entries.
+type repl struct {
+	newVM    vmFactory
+	filename string
+	out      io.Writer
+
+	grb       *gruby.GRuby
+	ctx       *gruby.CompileContext
+	stackKeep int
+	lastErr   *gruby.ExceptionError
+
+	historyFile string
+	historySize int
+}
+
+func newREPL(newVM vmFactory, filename string) (*repl, error) {
+	r := &repl{
+		newVM:       newVM,
+		filename:    filename,
+		out:         os.Stdout,
+		grb:         nil,
+		ctx:         nil,
+		stackKeep:   0,
+		lastErr:     nil,
+		historyFile: defaultHistoryFile(),
+		historySize: historySize(),
+	}
+
+	if err := r.reset(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Close frees the resources associated with the session, including the VM.
+func (r *repl) Close() {
+	if r.ctx != nil {
+		r.ctx.Close()
+	}
+
+	if r.grb != nil {
+		r.grb.Close()
+	}
+}
+
+// reset replaces the VM with a fresh one, dropping all the session state.
+func (r *repl) reset() error {
+	grb, err := r.newVM()
+	if err != nil {
+		return err
+	}
+
+	r.Close()
+
+	r.grb = grb
+	r.ctx = gruby.NewCompileContext(grb)
+	r.ctx.SetFilename(r.filename)
+	r.ctx.CaptureErrors(true)
+	r.stackKeep = 0
+	r.lastErr = nil
+
+	return nil
+}
+
+// Run reads and evaluates input until EOF or an interrupt on an empty prompt.
+func (r *repl) Run() error {
+	rln, err := readline.NewEx(&readline.Config{
+		Prompt:       prompt,
+		HistoryFile:  r.historyFile,
+		HistoryLimit: r.historySize,
+		AutoComplete: r,
+	})
+	if err != nil {
+		return fmt.Errorf("readline init error: %w", err)
+	}
+	defer rln.Close()
+
+	var buffer []string
+
+	for {
+		line, rErr := rln.Readline()
+		if rErr != nil {
+			// Ctrl-C in the middle of a multiline entry discards it.
+			if errors.Is(rErr, readline.ErrInterrupt) && len(buffer) > 0 {
+				buffer = nil
+				rln.SetPrompt(prompt)
+				continue
+			}
+
+			if errors.Is(rErr, io.EOF) || errors.Is(rErr, readline.ErrInterrupt) {
+				return nil
+			}
+
+			return fmt.Errorf("readline error: %w", rErr)
+		}
+
+		if len(buffer) == 0 && r.runCommand(line) {
+			continue
+		}
+
+		buffer = append(buffer, line)
+		code := strings.Join(buffer, "\n")
+
+		if strings.TrimSpace(code) == "" {
+			buffer = nil
+			continue
+		}
+
+		proc, pErr := r.parse(code)
+		if errors.Is(pErr, errIncompleteInput) {
+			rln.SetPrompt(continuationPrompt)
+			continue
+		}
+
+		buffer = nil
+		rln.SetPrompt(prompt)
+
+		if pErr != nil {
+			r.report(pErr)
+			continue
+		}
+
+		r.eval(proc)
+	}
+}
+
+// parse compiles the code into a proc. It returns errIncompleteInput if the
+// code is valid so far but needs more lines.
+func (r *repl) parse(code string) (gruby.Value, error) {
+	parser := gruby.NewParser(r.grb)
+	defer parser.Close()
+
+	if _, err := parser.Parse(code, r.ctx); err != nil {
+		if isIncompleteInput(err) {
+			return nil, errIncompleteInput
+		}
+
+		return nil, err
+	}
+
+	return parser.GenerateCode(), nil
+}
+
+// evalQuietly parses and runs the code in the session scope.
+func (r *repl) evalQuietly(code string) (gruby.Value, error) {
+	proc, err := r.parse(code)
+	if err != nil {
+		return nil, err
+	}
+
+	_, result, err := r.grb.RunWithContext(proc, nil, r.stackKeep)
+
+	return result, err
+}
+
+func (r *repl) eval(proc gruby.Value) {
+	defer r.grb.ArenaRestore(r.grb.ArenaSave())
+
+	stackKeep, result, err := r.grb.RunWithContext(proc, nil, r.stackKeep)
+	r.stackKeep = stackKeep
+
+	if err != nil {
+		r.report(err)
+		return
+	}
+
+	fmt.Fprintf(r.out, "=> %s\n", inspect(result))
+}
+
+// report prints the error and remembers it for :bt if it is a Ruby exception.
+func (r *repl) report(err error) {
+	var exc *gruby.ExceptionError
+	if errors.As(err, &exc) {
+		r.lastErr = exc
+	}
+
+	pp.Fprintf(r.out, "ERROR: %s\n", err.Error())
+}
+
+// defaultHistoryFile returns ~/.gruby_history, or an empty string if the home
+// directory is unknown, in which case history is kept in memory only.
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, historyFileName)
+}
+
+// historySize returns the number of history entries to keep, which can be
+// configured with the GRUBY_HISTORY_SIZE environment variable.
+func historySize() int {
+	size, err := strconv.Atoi(os.Getenv("GRUBY_HISTORY_SIZE"))
+	if err != nil || size <= 0 {
+		return defaultHistorySize
+	}
+
+	return size
+}
+
+func isIncompleteInput(err error) bool {
+	var parserErr *gruby.ParserError
+	if !errors.As(err, &parserErr) {
+		return false
+	}
+
+	for _, msg := range parserErr.Errors {
+		for _, fragment := range incompleteInputMessages {
+			if strings.Contains(msg.Message, fragment) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// inspect returns the result of calling `inspect` on the value.
+func inspect(v gruby.Value) string {
+	str, err := v.Call("inspect")
+	if err != nil {
+		return fmt.Sprintf("#<inspect failed: %s>", err.Error())
+	}
+
+	return str.String()
+}
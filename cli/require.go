@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhulik/gruby"
+)
+
+const loadPathVariable = "$LOAD_PATH"
+
+var errCannotLoad = errors.New("cannot load such file")
+
+// installLoader defines `require` and `require_relative` and initializes
+// $LOAD_PATH with the given directories. mruby has no `require` of its own.
+func installLoader(grb *gruby.GRuby, dirs []string) {
+	paths := make(gruby.Values, len(dirs))
+	for i, dir := range dirs {
+		paths[i] = gruby.MustToRuby(grb, dir)
+	}
+
+	grb.SetGlobalVariable(loadPathVariable, gruby.MustToRuby(grb, paths))
+
+	if !grb.ConstDefined("LoadError", grb.ObjectClass()) {
+		grb.DefineClass("LoadError", grb.Class("ScriptError", nil))
+	}
+
+	grb.ObjectClass().DefineMethod("require", rubyRequire, gruby.ArgsReq(1))
+	grb.ObjectClass().DefineMethod("require_relative", rubyRequireRelative, gruby.ArgsReq(1))
+}
+
+func rubyRequire(grb *gruby.GRuby, _ gruby.Value) (gruby.Value, gruby.Value) {
+	feature := grb.GetArgs()[0].String()
+
+	path, err := resolveFeature(feature, loadPaths(grb))
+	if err != nil {
+		return nil, loadError(grb, err)
+	}
+
+	return loadFeature(grb, path)
+}
+
+func rubyRequireRelative(grb *gruby.GRuby, _ gruby.Value) (gruby.Value, gruby.Value) {
+	feature := grb.GetArgs()[0].String()
+
+	base, err := filepath.Abs(filepath.Dir(grb.CalledFromFile()))
+	if err != nil {
+		return nil, loadError(grb, err)
+	}
+
+	path, err := resolveFeature(filepath.Join(base, feature), nil)
+	if err != nil {
+		return nil, loadError(grb, err)
+	}
+
+	return loadFeature(grb, path)
+}
+
+// requireFeature loads a feature the same way `require` does. It is used
+// for the -r flag.
+func requireFeature(grb *gruby.GRuby, feature string) error {
+	path, err := resolveFeature(feature, loadPaths(grb))
+	if err != nil {
+		return err
+	}
+
+	_, err = loadFile(grb, path)
+
+	return err
+}
+
+func loadFeature(grb *gruby.GRuby, path string) (gruby.Value, gruby.Value) {
+	loaded, err := loadFile(grb, path)
+	if err != nil {
+		var exc *gruby.ExceptionError
+		if errors.As(err, &exc) {
+			return nil, exc.Value
+		}
+
+		return nil, loadError(grb, err)
+	}
+
+	return gruby.MustToRuby(grb, loaded), nil
+}
+
+// loadFile loads the file unless it was already loaded and reports whether
+// it was loaded by this call.
+func loadFile(grb *gruby.GRuby, path string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	loaded, ctx, err := grb.LoadFile(path, string(content))
+	if ctx != nil {
+		ctx.Close()
+	}
+
+	return loaded, err
+}
+
+// resolveFeature finds the file for the feature. Absolute paths and paths
+// starting with ./ or ../ are used as is, everything else is looked up in
+// the load paths. The .rb extension is optional.
+func resolveFeature(feature string, dirs []string) (string, error) {
+	name := feature
+	if filepath.Ext(name) == "" {
+		name += ".rb"
+	}
+
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		dirs = []string{""}
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+
+		if stat, err := os.Stat(path); err == nil && !stat.IsDir() {
+			return filepath.Abs(path)
+		}
+	}
+
+	return "", fmt.Errorf("%w -- %s", errCannotLoad, feature)
+}
+
+func loadPaths(grb *gruby.GRuby) []string {
+	value := grb.GetGlobalVariable(loadPathVariable)
+	if value.Type() != gruby.TypeArray {
+		return nil
+	}
+
+	values := gruby.MustToGo[gruby.Values](value)
+
+	paths := make([]string, len(values))
+	for i, path := range values {
+		paths[i] = path.String()
+	}
+
+	return paths
+}
+
+func loadError(grb *gruby.GRuby, err error) gruby.Value {
+	exc, nErr := grb.Class("LoadError", nil).New(gruby.MustToRuby(grb, err.Error()))
+	if nErr != nil {
+		var excErr *gruby.ExceptionError
+		errors.As(nErr, &excErr)
+		return excErr.Value
+	}
+
+	return exc
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zhulik/gruby"
+)
+
+const (
+	bytecodeExt = ".mrb"
+
+	exprFilename  = "-e"
+	stdinFilename = "-"
+)
+
+var (
+	errNoScript        = errors.New("no script given")
+	errAlreadyCompiled = errors.New("script is already compiled")
+)
+
+// script is a program to run: Ruby source or mruby bytecode.
+type script struct {
+	filename string
+	content  []byte
+}
+
+func (s *script) isBytecode() bool {
+	return strings.HasSuffix(s.filename, bytecodeExt)
+}
+
+// readScript picks the program to run the same way ruby does: -e expressions,
+// the script named by the first argument ("-" for stdin) or stdin if it is
+// not a terminal. It returns nil if there is nothing to run and a REPL should
+// be started. The remaining arguments are returned as script's ARGV.
+func readScript(exprs []string, args []string) (*script, []string, error) {
+	if len(exprs) > 0 {
+		return &script{filename: exprFilename, content: []byte(strings.Join(exprs, "\n"))}, args, nil
+	}
+
+	if len(args) == 0 {
+		if isTerminal(os.Stdin) {
+			return nil, nil, nil
+		}
+
+		args = []string{stdinFilename}
+	}
+
+	if args[0] == stdinFilename {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+
+		return &script{filename: stdinFilename, content: content}, args[1:], nil
+	}
+
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read script: %w", err)
+	}
+
+	return &script{filename: args[0], content: content}, args[1:], nil
+}
+
+func runScript(grb *gruby.GRuby, src *script, args []string) int {
+	if err := execScript(grb, src, args); err != nil {
+		return reportError(err)
+	}
+
+	return 0
+}
+
+// execScript runs the script with ARGV and $0 set up.
+func execScript(grb *gruby.GRuby, src *script, args []string) error {
+	argv := make(gruby.Values, len(args))
+	for i, arg := range args {
+		argv[i] = gruby.MustToRuby(grb, arg)
+	}
+
+	grb.ObjectClass().DefineConst("ARGV", gruby.MustToRuby(grb, argv))
+	grb.SetGlobalVariable("$0", gruby.MustToRuby(grb, src.filename))
+
+	if src.isBytecode() {
+		_, err := grb.LoadBytecode(src.content)
+		return err
+	}
+
+	_, ctx, err := grb.LoadFile(src.filename, string(src.content))
+	if ctx != nil {
+		ctx.Close()
+	}
+
+	return err
+}
+
+// compileScript compiles the script into an .mrb file which can be executed
+// later with `gruby file.mrb`.
+func compileScript(grb *gruby.GRuby, src *script, out string) int {
+	if src.isBytecode() {
+		return reportError(fmt.Errorf("%w: %s", errAlreadyCompiled, src.filename))
+	}
+
+	parser := gruby.NewParser(grb)
+	defer parser.Close()
+
+	ctx := gruby.NewCompileContext(grb)
+	ctx.SetFilename(src.filename)
+	ctx.CaptureErrors(true)
+	defer ctx.Close()
+
+	if _, err := parser.Parse(string(src.content), ctx); err != nil {
+		return reportError(err)
+	}
+
+	bin, err := grb.DumpBytecode(parser.GenerateCode())
+	if err != nil {
+		return reportError(err)
+	}
+
+	if wErr := os.WriteFile(out, bin, 0o644); wErr != nil { //nolint:gosec,mnd
+		return reportError(fmt.Errorf("failed to write bytecode: %w", wErr))
+	}
+
+	return 0
+}
+
+// reportError prints the error to stderr and returns the exit status. Uncaught
+// Ruby exceptions are printed with their backtrace, the way ruby does it.
+func reportError(err error) int {
+	var exc *gruby.ExceptionError
+	if !errors.As(err, &exc) {
+		fmt.Fprintf(os.Stderr, "gruby: %s\n", err.Error())
+		return 1
+	}
+
+	className := exc.Class().String()
+
+	if className == "SystemExit" {
+		if status, sErr := exc.Call("status"); sErr == nil && status.Type() == gruby.TypeFixnum {
+			return gruby.MustToGo[int](status)
+		}
+	}
+
+	if len(exc.Backtrace) == 0 {
+		fmt.Fprintf(os.Stderr, "%s (%s)\n", exc.Message, className)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", exc.Backtrace[0], exc.Message, className)
+	for _, line := range exc.Backtrace[1:] {
+		fmt.Fprintf(os.Stderr, "\tfrom %s\n", line)
+	}
+
+	return 1
+}
+
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
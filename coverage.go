@@ -0,0 +1,183 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// FileCoverage maps the executable lines of a file to the number of times they
+// were executed.
+type FileCoverage map[int]int
+
+// CoverageReport maps filenames, as set with CompileContext.SetFilename or
+// LoadFile, to their coverage.
+type CoverageReport map[string]FileCoverage
+
+type coverage struct {
+	report CoverageReport
+	ireps  map[*C.mrb_irep]bool
+	remove func()
+}
+
+// StartCoverage starts recording which lines of the executed code run. Lines
+// of methods and blocks that are never called are reported too, with a count
+// of 0, as long as the file they are defined in is loaded after
+// StartCoverage. Calling it again discards the recorded coverage.
+//
+// Only code compiled with a filename is recorded.
+func (g *GRuby) StartCoverage() {
+	g.StopCoverage()
+
+	cov := &coverage{
+		report: CoverageReport{},
+		ireps:  map[*C.mrb_irep]bool{},
+		remove: nil,
+	}
+
+	cov.remove = g.addTraceListener(func(ev *TraceEvent) {
+		if ev.Type != TraceLine || ev.File == "" {
+			return
+		}
+
+		if !cov.ireps[ev.irep] {
+			cov.addIrep(g.state, ev.irep)
+		}
+
+		file := cov.file(ev.File)
+		file[ev.Line]++
+	})
+
+	g.coverage = cov
+}
+
+// StopCoverage stops recording and returns the coverage recorded since
+// StartCoverage. It returns nil if the coverage was not started.
+func (g *GRuby) StopCoverage() CoverageReport {
+	if g.coverage == nil {
+		return nil
+	}
+
+	cov := g.coverage
+	g.coverage = nil
+	cov.remove()
+
+	return cov.report
+}
+
+// addIrep registers the lines of the irep and of the ireps nested in it, like
+// methods and blocks, as executable.
+func (c *coverage) addIrep(state *C.mrb_state, irep *C.mrb_irep) {
+	c.ireps[irep] = true
+
+	for pc := C.uint32_t(0); pc < C._go_irep_ilen(irep); pc++ {
+		line := int(C.mrb_debug_get_line(state, irep, pc))
+		filename := C.mrb_debug_get_filename(state, irep, pc)
+
+		if line < 0 || filename == nil {
+			continue
+		}
+
+		file := c.file(C.GoString(filename))
+		if _, ok := file[line]; !ok {
+			file[line] = 0
+		}
+	}
+
+	for i := range int(C._go_irep_rlen(irep)) {
+		rep := C._go_irep_rep(irep, C.int(i))
+		if rep != nil && !c.ireps[rep] {
+			c.addIrep(state, rep)
+		}
+	}
+}
+
+func (c *coverage) file(name string) FileCoverage {
+	file, ok := c.report[name]
+	if !ok {
+		file = FileCoverage{}
+		c.report[name] = file
+	}
+
+	return file
+}
+
+// Covered returns the number of executed lines and of executable lines.
+func (f FileCoverage) Covered() (int, int) {
+	covered := 0
+
+	for _, count := range f {
+		if count > 0 {
+			covered++
+		}
+	}
+
+	return covered, len(f)
+}
+
+// Files returns the sorted names of the files in the report.
+func (r CoverageReport) Files() []string {
+	files := make([]string, 0, len(r))
+	for file := range r {
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	return files
+}
+
+// WriteLCOV writes the report in the LCOV tracefile format, understood by
+// genhtml and most coverage services.
+func (r CoverageReport) WriteLCOV(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	for _, name := range r.Files() {
+		file := r[name]
+
+		fmt.Fprintf(out, "TN:\nSF:%s\n", name)
+
+		for _, line := range file.lines() {
+			fmt.Fprintf(out, "DA:%d,%d\n", line, file[line])
+		}
+
+		covered, total := file.Covered()
+		fmt.Fprintf(out, "LF:%d\nLH:%d\nend_of_record\n", total, covered)
+	}
+
+	return out.Flush() //nolint:wrapcheck
+}
+
+// WriteGoCover writes the report in the format of Go's cover profiles, as
+// written by go test -coverprofile with -covermode=count. Every line is a
+// block with a single statement.
+func (r CoverageReport) WriteGoCover(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintln(out, "mode: count")
+
+	for _, name := range r.Files() {
+		file := r[name]
+
+		for _, line := range file.lines() {
+			fmt.Fprintf(out, "%s:%d.1,%d.1 1 %d\n", name, line, line+1, file[line])
+		}
+	}
+
+	return out.Flush() //nolint:wrapcheck
+}
+
+func (f FileCoverage) lines() []int {
+	lines := make([]int, 0, len(f))
+	for line := range f {
+		lines = append(lines, line)
+	}
+
+	sort.Ints(lines)
+
+	return lines
+}
@@ -0,0 +1,95 @@
+package gruby_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestCoverage(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	g.Expect(grb.StopCoverage()).To(BeNil())
+
+	grb.StartCoverage()
+
+	_, _, err := grb.LoadFile("rules.rb", `def allowed?(age)
+  if age >= 18
+    true
+  else
+    false
+  end
+end
+
+def unused
+  42
+end
+
+allowed?(21)
+allowed?(30)
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	report := grb.StopCoverage()
+	g.Expect(report.Files()).To(Equal([]string{"rules.rb"}))
+
+	file := report["rules.rb"]
+	g.Expect(file).To(HaveKeyWithValue(2, 2))
+	g.Expect(file).To(HaveKeyWithValue(3, 2))
+	g.Expect(file).To(HaveKeyWithValue(5, 0))
+	g.Expect(file).To(HaveKeyWithValue(10, 0))
+	g.Expect(file).To(HaveKeyWithValue(13, 1))
+
+	covered, total := file.Covered()
+	g.Expect(covered).To(BeNumerically("<", total))
+
+	var lcov bytes.Buffer
+	g.Expect(report.WriteLCOV(&lcov)).To(Succeed())
+	g.Expect(lcov.String()).To(HavePrefix("TN:\nSF:rules.rb\n"))
+	g.Expect(lcov.String()).To(ContainSubstring("DA:3,2\n"))
+	g.Expect(lcov.String()).To(ContainSubstring("DA:10,0\n"))
+	g.Expect(lcov.String()).To(HaveSuffix("end_of_record\n"))
+
+	var profile bytes.Buffer
+	g.Expect(report.WriteGoCover(&profile)).To(Succeed())
+	g.Expect(profile.String()).To(HavePrefix("mode: count\n"))
+	g.Expect(profile.String()).To(ContainSubstring("rules.rb:3.1,4.1 1 2\n"))
+	g.Expect(profile.String()).To(ContainSubstring("rules.rb:5.1,6.1 1 0\n"))
+
+	_, err = grb.LoadString(`allowed?(1)`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report["rules.rb"][5]).To(BeZero())
+}
+
+func TestCoverageLoop(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	grb.StartCoverage()
+
+	_, _, err := grb.LoadFile("loop.rb", `def total(items)
+  sum = 0
+  items.each { |item| sum += item }
+  sum
+end
+
+total([1, 2, 3])
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The block runs once per item, each run is a hit on top of the call
+	// to each.
+	file := grb.StopCoverage()["loop.rb"]
+	g.Expect(file).To(HaveKeyWithValue(2, 1))
+	g.Expect(file[3]).To(BeNumerically(">=", 4))
+	g.Expect(file).To(HaveKeyWithValue(4, 1))
+}
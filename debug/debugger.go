@@ -0,0 +1,460 @@
+// Package debug implements a debugger for gruby: breakpoints, stepping and
+// inspection of the paused frame. Server exposes it through the Debug Adapter
+// Protocol, so scripts can be debugged from editors like VS Code.
+//
+// Evaluation in the paused frame relies on the mruby-binding and mruby-eval
+// gems, both are part of gruby's default build config.
+package debug
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/zhulik/gruby"
+)
+
+// ErrNotPaused is returned when the paused frame is inspected or the
+// execution is resumed while the VM is running.
+var ErrNotPaused = errors.New("execution is not paused")
+
+// StopReason tells why the execution was paused.
+type StopReason string
+
+const (
+	// StopBreakpoint means a breakpoint was hit.
+	StopBreakpoint StopReason = "breakpoint"
+	// StopStep means a step was completed.
+	StopStep StopReason = "step"
+	// StopPause means Pause was called.
+	StopPause StopReason = "pause"
+	// StopEntry means the execution was paused before the first line.
+	StopEntry StopReason = "entry"
+)
+
+// Stop describes where and why the execution was paused.
+type Stop struct {
+	Reason StopReason
+	File   string
+	Line   int
+}
+
+// Frame is an entry of the call stack of the paused execution, the innermost
+// first.
+type Frame struct {
+	Name string
+	File string
+	Line int
+}
+
+// Variable is a local variable, an instance variable or the result of an
+// evaluation, its value is formatted with inspect.
+type Variable struct {
+	Name  string
+	Value string
+	Type  string
+}
+
+type stepMode int
+
+const (
+	modeContinue stepMode = iota
+	modeStepIn
+	modeStepOver
+	modeStepOut
+	modeStop
+)
+
+// backtraceLine matches the entries of mruby backtraces: "file:line" or
+// "file:line:in method".
+var backtraceLine = regexp.MustCompile(`^(.*):(\d+)(?::in (.*))?$`)
+
+// Debugger pauses a VM on breakpoints and steps and inspects the paused frame.
+//
+// The execution is paused on the goroutine running the VM, which waits until
+// Continue or one of the step methods is called from another goroutine. While
+// paused, the inspection methods run their Ruby code on the VM goroutine.
+// The Debugger is meant to be controlled by a single goroutine, like a
+// Server's session.
+type Debugger struct {
+	grb        *gruby.GRuby
+	onStop     func(Stop)
+	removeHook func()
+
+	lock        sync.Mutex
+	closed      bool
+	breakpoints map[string]map[int]bool
+	paths       map[string]string
+	mode        stepMode
+	stopReason  StopReason
+	stepFrom    gruby.TraceEvent
+	current     *gruby.TraceEvent
+
+	commands chan func()
+	resumed  chan struct{}
+}
+
+// New attaches a debugger to the VM. onStop is called on the VM goroutine every
+// time the execution is paused, it must not call the Debugger's methods
+// itself.
+func New(grb *gruby.GRuby, onStop func(Stop)) *Debugger {
+	debugger := &Debugger{
+		grb:         grb,
+		onStop:      onStop,
+		removeHook:  nil,
+		lock:        sync.Mutex{},
+		closed:      false,
+		breakpoints: map[string]map[int]bool{},
+		paths:       map[string]string{},
+		mode:        modeContinue,
+		stopReason:  "",
+		stepFrom:    gruby.TraceEvent{}, //nolint:exhaustruct
+		current:     nil,
+		commands:    make(chan func()),
+		resumed:     make(chan struct{}, 1),
+	}
+
+	debugger.removeHook = grb.AddTraceHook(debugger.onEvent)
+
+	return debugger
+}
+
+// Close detaches the debugger and resumes the execution if it is paused. The
+// trace hook itself is removed the next time the VM executes a line, as it
+// may only be touched from the VM goroutine.
+func (d *Debugger) Close() {
+	d.lock.Lock()
+	d.closed = true
+	d.lock.Unlock()
+
+	_ = d.resume(modeContinue)
+}
+
+// SetBreakpoints replaces the breakpoints of the file with the given lines.
+// Paths are compared after making them absolute, so relative filenames set
+// with CompileContext.SetFilename are resolved against the working directory.
+func (d *Debugger) SetBreakpoints(file string, lines []int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	path := d.normalize(file)
+	if len(lines) == 0 {
+		delete(d.breakpoints, path)
+		return
+	}
+
+	set := make(map[int]bool, len(lines))
+	for _, line := range lines {
+		set[line] = true
+	}
+
+	d.breakpoints[path] = set
+}
+
+// Pause stops the execution on the next line it executes.
+func (d *Debugger) Pause() {
+	d.stopOnNextLine(StopPause)
+}
+
+// Continue resumes the execution until the next breakpoint.
+func (d *Debugger) Continue() error {
+	return d.resume(modeContinue)
+}
+
+// StepIn resumes the execution until the next line, entering method calls.
+func (d *Debugger) StepIn() error {
+	return d.resume(modeStepIn)
+}
+
+// StepOver resumes the execution until the next line of the current frame or
+// of one of its callers.
+func (d *Debugger) StepOver() error {
+	return d.resume(modeStepOver)
+}
+
+// StepOut resumes the execution until the current frame returns.
+func (d *Debugger) StepOut() error {
+	return d.resume(modeStepOut)
+}
+
+// StackTrace returns the call stack of the paused execution.
+func (d *Debugger) StackTrace() ([]Frame, error) {
+	var frames []Frame
+
+	err := d.do(func(ev *gruby.TraceEvent) error {
+		for _, line := range d.grb.Backtrace() {
+			match := backtraceLine.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			lineNo, _ := strconv.Atoi(match[2])
+			frames = append(frames, Frame{Name: frameName(match[3]), File: match[1], Line: lineNo})
+		}
+
+		// The backtrace is not updated until the frame calls another method,
+		// the event knows better where the paused frame is.
+		top := Frame{Name: frameName(ev.Method), File: ev.File, Line: ev.Line}
+		if len(frames) == 0 {
+			frames = []Frame{top}
+		} else {
+			frames[0] = top
+		}
+
+		return nil
+	})
+
+	return frames, err
+}
+
+// Locals returns the local variables of the paused frame.
+func (d *Debugger) Locals() ([]Variable, error) {
+	var variables []Variable
+
+	err := d.do(func(ev *gruby.TraceEvent) error {
+		binding, err := ev.Self.Call("binding")
+		if err != nil {
+			return err
+		}
+
+		variables, err = listVariables(binding, "local_variables", "local_variable_get")
+
+		return err
+	})
+
+	return variables, err
+}
+
+// InstanceVariables returns the instance variables of self in the paused
+// frame.
+func (d *Debugger) InstanceVariables() ([]Variable, error) {
+	var variables []Variable
+
+	err := d.do(func(ev *gruby.TraceEvent) error {
+		var err error
+
+		variables, err = listVariables(ev.Self, "instance_variables", "instance_variable_get")
+
+		return err
+	})
+
+	return variables, err
+}
+
+// Evaluate evaluates the expression in the context of the paused frame, with
+// access to its self and local variables. Ruby exceptions are returned as
+// *gruby.ExceptionError.
+func (d *Debugger) Evaluate(expr string) (Variable, error) {
+	var result Variable
+
+	err := d.do(func(ev *gruby.TraceEvent) error {
+		binding, err := ev.Self.Call("binding")
+		if err != nil {
+			return err
+		}
+
+		value, err := binding.Call("eval", gruby.MustToRuby(d.grb, expr))
+		if err != nil {
+			return err
+		}
+
+		result = newVariable(expr, value)
+
+		return nil
+	})
+
+	return result, err
+}
+
+func (d *Debugger) onEvent(ev gruby.TraceEvent) {
+	if ev.Type != gruby.TraceLine {
+		return
+	}
+
+	reason, ok := d.shouldStop(&ev)
+	if !ok {
+		return
+	}
+
+	d.lock.Lock()
+	d.current = &ev
+	d.lock.Unlock()
+
+	d.onStop(Stop{Reason: reason, File: ev.File, Line: ev.Line})
+
+	for {
+		select {
+		case cmd := <-d.commands:
+			cmd()
+		case <-d.resumed:
+			return
+		}
+	}
+}
+
+func (d *Debugger) shouldStop(ev *gruby.TraceEvent) (StopReason, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		if d.removeHook != nil {
+			d.removeHook()
+			d.removeHook = nil
+		}
+
+		return "", false
+	}
+
+	if d.breakpoints[d.normalize(ev.File)][ev.Line] {
+		d.mode = modeContinue
+		return StopBreakpoint, true
+	}
+
+	from := d.stepFrom
+	sameLine := ev.Depth == from.Depth && ev.File == from.File && ev.Line == from.Line
+
+	var stop bool
+
+	switch d.mode {
+	case modeContinue:
+		return "", false
+	case modeStop:
+		stop = true
+	case modeStepIn:
+		stop = !sameLine
+	case modeStepOver:
+		stop = ev.Depth < from.Depth || (ev.Depth == from.Depth && !sameLine)
+	case modeStepOut:
+		stop = ev.Depth < from.Depth
+	}
+
+	if !stop {
+		return "", false
+	}
+
+	reason := StopStep
+	if d.mode == modeStop {
+		reason = d.stopReason
+	}
+
+	d.mode = modeContinue
+
+	return reason, true
+}
+
+// stopOnNextLine pauses the execution on the next executed line, reporting the
+// given reason.
+func (d *Debugger) stopOnNextLine(reason StopReason) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.mode = modeStop
+	d.stopReason = reason
+}
+
+func (d *Debugger) resume(mode stepMode) error {
+	d.lock.Lock()
+
+	if d.current == nil {
+		d.lock.Unlock()
+		return ErrNotPaused
+	}
+
+	d.mode = mode
+	d.stepFrom = *d.current
+	d.current = nil
+	d.lock.Unlock()
+
+	d.resumed <- struct{}{}
+
+	return nil
+}
+
+// do runs fn on the VM goroutine, in the context of the paused frame.
+func (d *Debugger) do(fn func(ev *gruby.TraceEvent) error) error {
+	d.lock.Lock()
+	ev := d.current
+	d.lock.Unlock()
+
+	if ev == nil {
+		return ErrNotPaused
+	}
+
+	errs := make(chan error, 1)
+	d.commands <- func() {
+		// Everything fn needs is converted to Go values before it returns.
+		idx := d.grb.ArenaSave()
+		defer d.grb.ArenaRestore(idx)
+
+		errs <- fn(ev)
+	}
+
+	return <-errs
+}
+
+// normalize returns the key breakpoints are stored with, the caller must hold
+// the lock.
+func (d *Debugger) normalize(file string) string {
+	if path, ok := d.paths[file]; ok {
+		return path
+	}
+
+	path, err := filepath.Abs(file)
+	if err != nil {
+		path = filepath.Clean(file)
+	}
+
+	d.paths[file] = path
+
+	return path
+}
+
+// listVariables lists variables of the receiver, with methods like
+// local_variables and local_variable_get.
+func listVariables(receiver gruby.Value, list string, get string) ([]Variable, error) {
+	names, err := receiver.Call(list)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols, err := gruby.ToGo[gruby.Values](names)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := make([]Variable, 0, len(symbols))
+
+	for _, symbol := range symbols {
+		value, gErr := receiver.Call(get, symbol)
+		if gErr != nil {
+			return nil, gErr
+		}
+
+		variables = append(variables, newVariable(symbol.String(), value))
+	}
+
+	return variables, nil
+}
+
+func newVariable(name string, value gruby.Value) Variable {
+	return Variable{Name: name, Value: inspect(value), Type: value.Class().String()}
+}
+
+func inspect(value gruby.Value) string {
+	str, err := value.Call("inspect")
+	if err != nil {
+		return "#<inspect failed: " + err.Error() + ">"
+	}
+
+	return str.String()
+}
+
+func frameName(method string) string {
+	if method == "" {
+		return "<main>"
+	}
+
+	return method
+}
@@ -0,0 +1,133 @@
+package debug_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+	"github.com/zhulik/gruby/debug"
+)
+
+const counterScript = `class Counter
+  def initialize
+    @count = 0
+  end
+
+  def add(n)
+    total = @count + n
+    @count = total
+  end
+end
+
+counter = Counter.new
+counter.add(2)
+counter.add(3)
+`
+
+// startDebugged runs the code in the background with a debugger attached,
+// setup is called before the code starts.
+func startDebugged(grb *gruby.GRuby, code string, setup func(*debug.Debugger)) (*debug.Debugger, chan debug.Stop, chan error) {
+	stops := make(chan debug.Stop, 1)
+	done := make(chan error, 1)
+
+	debugger := debug.New(grb, func(stop debug.Stop) { stops <- stop })
+	setup(debugger)
+
+	go func() {
+		ctx := gruby.NewCompileContext(grb)
+		defer ctx.Close()
+		ctx.SetFilename("counter.rb")
+
+		_, err := grb.LoadStringWithContext(code, ctx)
+		done <- err
+	}()
+
+	return debugger, stops, done
+}
+
+func TestDebugger(t *testing.T) {
+	t.Parallel()
+	g := NewWithT(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	var stop debug.Stop
+
+	debugger, stops, done := startDebugged(grb, counterScript, func(debugger *debug.Debugger) {
+		debugger.SetBreakpoints("counter.rb", []int{7})
+
+		_, err := debugger.Locals()
+		g.Expect(err).To(MatchError(debug.ErrNotPaused))
+	})
+	defer debugger.Close()
+
+	g.Eventually(stops, time.Second).Should(Receive(&stop))
+	g.Expect(stop).To(Equal(debug.Stop{Reason: debug.StopBreakpoint, File: "counter.rb", Line: 7}))
+
+	locals, err := debugger.Locals()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(locals).To(ContainElement(debug.Variable{Name: "n", Value: "2", Type: "Integer"}))
+
+	frames, err := debugger.StackTrace()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(frames[0]).To(Equal(debug.Frame{Name: "add", File: "counter.rb", Line: 7}))
+	g.Expect(frames).To(ContainElement(HaveField("Line", 13)))
+
+	g.Expect(debugger.StepOver()).To(Succeed())
+	g.Eventually(stops, time.Second).Should(Receive(&stop))
+	g.Expect(stop).To(Equal(debug.Stop{Reason: debug.StopStep, File: "counter.rb", Line: 8}))
+
+	result, err := debugger.Evaluate("total * 10")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.Value).To(Equal("20"))
+
+	_, err = debugger.Evaluate("raise 'oops'")
+	g.Expect(err).To(MatchError("oops"))
+
+	ivars, err := debugger.InstanceVariables()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ivars).To(ConsistOf(debug.Variable{Name: "@count", Value: "0", Type: "Integer"}))
+
+	g.Expect(debugger.StepOut()).To(Succeed())
+	g.Eventually(stops, time.Second).Should(Receive(&stop))
+	g.Expect(stop.Reason).To(Equal(debug.StopStep))
+	g.Expect(stop.Line).To(BeNumerically(">=", 13))
+
+	g.Expect(debugger.Continue()).To(Succeed())
+	g.Eventually(stops, time.Second).Should(Receive(&stop))
+	g.Expect(stop.Line).To(Equal(7))
+
+	locals, err = debugger.Locals()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(locals).To(ContainElement(HaveField("Value", "3")))
+
+	debugger.SetBreakpoints("counter.rb", nil)
+	g.Expect(debugger.Continue()).To(Succeed())
+	g.Eventually(done, time.Second).Should(Receive(BeNil()))
+	g.Expect(debugger.Continue()).To(MatchError(debug.ErrNotPaused))
+}
+
+func TestDebugger_Pause(t *testing.T) {
+	t.Parallel()
+	g := NewWithT(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	var stop debug.Stop
+
+	debugger, stops, done := startDebugged(grb, counterScript, (*debug.Debugger).Pause)
+
+	g.Eventually(stops, time.Second).Should(Receive(&stop))
+	g.Expect(stop).To(Equal(debug.Stop{Reason: debug.StopPause, File: "counter.rb", Line: 1}))
+
+	g.Expect(debugger.StepIn()).To(Succeed())
+	g.Eventually(stops, time.Second).Should(Receive(&stop))
+	g.Expect(stop.Reason).To(Equal(debug.StopStep))
+	g.Expect(stop.Line).ToNot(Equal(1))
+
+	debugger.Close()
+	g.Eventually(done, time.Second).Should(Receive(BeNil()))
+}
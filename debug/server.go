@@ -0,0 +1,651 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zhulik/gruby"
+)
+
+const (
+	// The program runs on a single thread, DAP requires an id for it.
+	threadID = 1
+
+	localsReference            = 1
+	instanceVariablesReference = 2
+
+	contentLengthHeader = "Content-Length: "
+
+	// maxContentLength bounds the size of the messages clients send, so a
+	// header can't make the server allocate any amount of memory.
+	maxContentLength = 4 << 20
+)
+
+var (
+	errMissingContentLength = errors.New("missing Content-Length header")
+	errMessageTooLarge      = errors.New("message too large")
+	errUnsupportedRequest   = errors.New("unsupported request")
+	errNoProgram            = errors.New("program is not running")
+)
+
+// VMFactory creates the VM a debug session runs its program in.
+type VMFactory func() (*gruby.GRuby, error)
+
+// RunFunc runs the program of a launch request in the VM.
+type RunFunc func(grb *gruby.GRuby, program string, args []string) error
+
+// Server serves debug sessions over the Debug Adapter Protocol. Every session
+// launches its program in a new VM.
+type Server struct {
+	newVM VMFactory
+	run   RunFunc
+}
+
+// NewServer creates a server launching programs in VMs created by newVM. If
+// run is nil, RunFile is used.
+func NewServer(newVM VMFactory, run RunFunc) *Server {
+	if run == nil {
+		run = RunFile
+	}
+
+	return &Server{newVM: newVM, run: run}
+}
+
+// RunFile loads the program file, its arguments are available in ARGV.
+func RunFile(grb *gruby.GRuby, program string, args []string) error {
+	content, err := os.ReadFile(program)
+	if err != nil {
+		return fmt.Errorf("failed to read program: %w", err)
+	}
+
+	argv := make(gruby.Values, len(args))
+	for i, arg := range args {
+		argv[i] = gruby.MustToRuby(grb, arg)
+	}
+
+	grb.ObjectClass().DefineConst("ARGV", gruby.MustToRuby(grb, argv))
+
+	_, ctx, err := grb.LoadFile(program, string(content))
+	if ctx != nil {
+		ctx.Close()
+	}
+
+	return err
+}
+
+// ListenAndServe accepts TCP connections on the address and serves a debug
+// session on each of them. Without a host, like ":4711", it listens on the
+// loopback interface only.
+//
+// Sessions are not authenticated and clients can launch programs and
+// evaluate code, so anyone who can connect can run code as the server's
+// user. Don't listen on addresses reachable by untrusted hosts.
+func (s *Server) ListenAndServe(addr string) error {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	defer listener.Close()
+
+	for {
+		conn, aErr := listener.Accept()
+		if aErr != nil {
+			return fmt.Errorf("failed to accept: %w", aErr)
+		}
+
+		go func() {
+			defer conn.Close()
+			_ = s.Serve(conn)
+		}()
+	}
+}
+
+// Serve serves a single debug session over the connection, like a net.Conn
+// or stdin and stdout. It returns when the client disconnects.
+func (s *Server) Serve(conn io.ReadWriter) error {
+	sess := &session{
+		server:      s,
+		reader:      bufio.NewReader(conn),
+		writer:      conn,
+		writeLock:   sync.Mutex{},
+		seq:         0,
+		lock:        sync.Mutex{},
+		launch:      nil,
+		breakpoints: map[string][]int{},
+		debugger:    nil,
+	}
+
+	return sess.serve()
+}
+
+type request struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type response struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"` //nolint:tagliatelle
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+type launchArguments struct {
+	Program     string   `json:"program"`
+	Args        []string `json:"args"`
+	StopOnEntry bool     `json:"stopOnEntry"`
+}
+
+type source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path"`
+}
+
+type sourceBreakpoint struct {
+	Line int `json:"line"`
+}
+
+type setBreakpointsArguments struct {
+	Source      source             `json:"source"`
+	Breakpoints []sourceBreakpoint `json:"breakpoints"`
+}
+
+type breakpoint struct {
+	Verified bool `json:"verified"`
+	Line     int  `json:"line"`
+}
+
+type stackFrame struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Source source `json:"source"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+type scopesArguments struct {
+	FrameID int `json:"frameId"`
+}
+
+type scope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type variablesArguments struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+type variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type evaluateArguments struct {
+	Expression string `json:"expression"`
+	FrameID    int    `json:"frameId"`
+}
+
+type evaluateResult struct {
+	Result             string `json:"result"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type session struct {
+	server *Server
+	reader *bufio.Reader
+	writer io.Writer
+
+	writeLock sync.Mutex
+	seq       int
+
+	lock        sync.Mutex
+	launch      *launchArguments
+	breakpoints map[string][]int
+	debugger    *Debugger
+}
+
+func (s *session) serve() error {
+	for {
+		req, err := s.readRequest()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				s.detach()
+				return nil
+			}
+
+			return err
+		}
+
+		body, err := s.handle(req)
+
+		if wErr := s.respond(req, body, err); wErr != nil {
+			return wErr
+		}
+
+		if err == nil {
+			s.afterResponse(req)
+		}
+
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// handle executes the request and returns the body of its response.
+func (s *session) handle(req *request) (any, error) { //nolint:cyclop
+	switch req.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		}, nil
+	case "launch":
+		return nil, s.handleLaunch(req)
+	case "setBreakpoints":
+		return s.handleSetBreakpoints(req)
+	case "setExceptionBreakpoints", "configurationDone", "disconnect":
+		return nil, nil
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": threadID, "name": "main"}}}, nil
+	case "stackTrace":
+		return s.handleStackTrace()
+	case "scopes":
+		return s.handleScopes(req)
+	case "variables":
+		return s.handleVariables(req)
+	case "evaluate":
+		return s.handleEvaluate(req)
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, nil
+	case "next", "stepIn", "stepOut", "pause":
+		_, err := s.currentDebugger()
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("%w: %s", errUnsupportedRequest, req.Command)
+}
+
+// afterResponse resumes or starts the program, the client must receive the
+// response before the events caused by it.
+func (s *session) afterResponse(req *request) {
+	switch req.Command {
+	case "configurationDone":
+		go s.runProgram()
+		return
+	case "disconnect":
+		s.detach()
+		return
+	}
+
+	debugger, err := s.currentDebugger()
+	if err != nil {
+		return
+	}
+
+	switch req.Command {
+	case "continue":
+		err = debugger.Continue()
+	case "next":
+		err = debugger.StepOver()
+	case "stepIn":
+		err = debugger.StepIn()
+	case "stepOut":
+		err = debugger.StepOut()
+	case "pause":
+		debugger.Pause()
+	}
+
+	if err != nil {
+		s.output("stderr", err.Error()+"\n")
+	}
+}
+
+func (s *session) handleLaunch(req *request) error {
+	var args launchArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return fmt.Errorf("invalid launch arguments: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.launch = &args
+
+	return nil
+}
+
+func (s *session) handleSetBreakpoints(req *request) (any, error) {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return nil, fmt.Errorf("invalid setBreakpoints arguments: %w", err)
+	}
+
+	lines := make([]int, len(args.Breakpoints))
+	breakpoints := make([]breakpoint, len(args.Breakpoints))
+
+	for i, bp := range args.Breakpoints {
+		lines[i] = bp.Line
+		breakpoints[i] = breakpoint{Verified: true, Line: bp.Line}
+	}
+
+	s.lock.Lock()
+	s.breakpoints[args.Source.Path] = lines
+	debugger := s.debugger
+	s.lock.Unlock()
+
+	if debugger != nil {
+		debugger.SetBreakpoints(args.Source.Path, lines)
+	}
+
+	return map[string]any{"breakpoints": breakpoints}, nil
+}
+
+func (s *session) handleStackTrace() (any, error) {
+	debugger, err := s.currentDebugger()
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := debugger.StackTrace()
+	if err != nil {
+		return nil, err
+	}
+
+	stackFrames := make([]stackFrame, len(frames))
+	for i, frame := range frames {
+		stackFrames[i] = stackFrame{
+			ID:     i,
+			Name:   frame.Name,
+			Source: source{Name: frame.File, Path: frame.File},
+			Line:   frame.Line,
+			Column: 1,
+		}
+	}
+
+	return map[string]any{"stackFrames": stackFrames, "totalFrames": len(stackFrames)}, nil
+}
+
+// handleScopes only exposes the variables of the innermost frame, it is the
+// only one mruby lets us inspect.
+func (s *session) handleScopes(req *request) (any, error) {
+	var args scopesArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return nil, fmt.Errorf("invalid scopes arguments: %w", err)
+	}
+
+	scopes := []scope{}
+	if args.FrameID == 0 {
+		scopes = []scope{
+			{Name: "Locals", VariablesReference: localsReference, Expensive: false},
+			{Name: "Instance variables", VariablesReference: instanceVariablesReference, Expensive: false},
+		}
+	}
+
+	return map[string]any{"scopes": scopes}, nil
+}
+
+func (s *session) handleVariables(req *request) (any, error) {
+	var args variablesArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return nil, fmt.Errorf("invalid variables arguments: %w", err)
+	}
+
+	debugger, err := s.currentDebugger()
+	if err != nil {
+		return nil, err
+	}
+
+	var vars []Variable
+
+	switch args.VariablesReference {
+	case localsReference:
+		vars, err = debugger.Locals()
+	case instanceVariablesReference:
+		vars, err = debugger.InstanceVariables()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	variables := make([]variable, len(vars))
+	for i, v := range vars {
+		variables[i] = variable{Name: v.Name, Value: v.Value, Type: v.Type, VariablesReference: 0}
+	}
+
+	return map[string]any{"variables": variables}, nil
+}
+
+func (s *session) handleEvaluate(req *request) (any, error) {
+	var args evaluateArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return nil, fmt.Errorf("invalid evaluate arguments: %w", err)
+	}
+
+	debugger, err := s.currentDebugger()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := debugger.Evaluate(args.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluateResult{Result: result.Value, Type: result.Type, VariablesReference: 0}, nil
+}
+
+// runProgram runs the launched program in a new VM, on its own goroutine.
+func (s *session) runProgram() {
+	s.lock.Lock()
+	launch := s.launch
+	s.lock.Unlock()
+
+	if launch == nil {
+		s.output("stderr", "no program was launched\n")
+		s.exit(1)
+
+		return
+	}
+
+	grb, err := s.server.newVM()
+	if err != nil {
+		s.output("stderr", err.Error()+"\n")
+		s.exit(1)
+
+		return
+	}
+	defer grb.Close()
+
+	debugger := New(grb, s.stopped)
+	defer debugger.Close()
+
+	s.lock.Lock()
+	for file, lines := range s.breakpoints {
+		debugger.SetBreakpoints(file, lines)
+	}
+	s.debugger = debugger
+	s.lock.Unlock()
+
+	if launch.StopOnEntry {
+		debugger.stopOnNextLine(StopEntry)
+	}
+
+	err = s.server.run(grb, launch.Program, launch.Args)
+
+	s.lock.Lock()
+	s.debugger = nil
+	s.lock.Unlock()
+
+	if err != nil {
+		s.output("stderr", err.Error()+"\n")
+		s.exit(1)
+
+		return
+	}
+
+	s.exit(0)
+}
+
+func (s *session) stopped(stop Stop) {
+	_ = s.sendEvent("stopped", map[string]any{
+		"reason":            string(stop.Reason),
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	})
+}
+
+func (s *session) exit(code int) {
+	_ = s.sendEvent("exited", map[string]any{"exitCode": code})
+	_ = s.sendEvent("terminated", nil)
+}
+
+func (s *session) output(category string, text string) {
+	_ = s.sendEvent("output", map[string]any{"category": category, "output": text})
+}
+
+// detach lets the program run to completion without the debugger.
+func (s *session) detach() {
+	s.lock.Lock()
+	debugger := s.debugger
+	s.lock.Unlock()
+
+	if debugger != nil {
+		debugger.Close()
+	}
+}
+
+func (s *session) currentDebugger() (*Debugger, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.debugger == nil {
+		return nil, errNoProgram
+	}
+
+	return s.debugger, nil
+}
+
+func (s *session) readRequest() (*request, error) {
+	length := -1
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		if value, ok := strings.CutPrefix(line, contentLengthHeader); ok {
+			length, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %w", err)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, errMissingContentLength
+	}
+
+	if length > maxContentLength {
+		return nil, fmt.Errorf("%w: %d bytes", errMessageTooLarge, length)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, content); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	var req request
+	if err := json.Unmarshal(content, &req); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+
+	return &req, nil
+}
+
+func (s *session) respond(req *request, body any, err error) error {
+	resp := response{
+		Seq:        0,
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Message:    "",
+		Body:       body,
+	}
+
+	if err != nil {
+		resp.Message = err.Error()
+		resp.Body = nil
+	}
+
+	if wErr := s.write(func(seq int) any { resp.Seq = seq; return resp }); wErr != nil {
+		return wErr
+	}
+
+	if req.Command == "initialize" && err == nil {
+		return s.sendEvent("initialized", nil)
+	}
+
+	return nil
+}
+
+func (s *session) sendEvent(name string, body any) error {
+	return s.write(func(seq int) any {
+		return event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// write sends a message built with the next sequence number.
+func (s *session) write(build func(seq int) any) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	s.seq++
+
+	content, err := json.Marshal(build(s.seq))
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	if _, err = fmt.Fprintf(s.writer, "%s%d\r\n\r\n%s", contentLengthHeader, len(content), content); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
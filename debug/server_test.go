@@ -0,0 +1,202 @@
+package debug_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+	"github.com/zhulik/gruby/debug"
+)
+
+type dapMessage struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"` //nolint:tagliatelle
+	Success    bool            `json:"success"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type dapClient struct {
+	conn     net.Conn
+	seq      int
+	messages chan dapMessage
+}
+
+func newDAPClient(conn net.Conn) *dapClient {
+	client := &dapClient{conn: conn, seq: 0, messages: make(chan dapMessage, 100)}
+
+	go func() {
+		reader := bufio.NewReader(conn)
+
+		for {
+			header, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			length, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+			_, _ = reader.ReadString('\n')
+
+			content := make([]byte, length)
+			if _, err = io.ReadFull(reader, content); err != nil {
+				return
+			}
+
+			var msg dapMessage
+			_ = json.Unmarshal(content, &msg)
+			client.messages <- msg
+		}
+	}()
+
+	return client
+}
+
+func (c *dapClient) send(command string, args any) {
+	c.seq++
+
+	content, _ := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(content), content)
+}
+
+// expect waits for a response to the command or for an event with the name,
+// skipping other messages.
+func (c *dapClient) expect(g Gomega, kind string, name string, body any) dapMessage {
+	var msg dapMessage
+
+	g.Eventually(func() bool {
+		select {
+		case msg = <-c.messages:
+			return msg.Type == kind && (msg.Command == name || msg.Event == name)
+		default:
+			return false
+		}
+	}, time.Second).Should(BeTrue())
+
+	if body != nil {
+		g.Expect(json.Unmarshal(msg.Body, body)).To(Succeed())
+	}
+
+	return msg
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	g := NewWithT(t)
+
+	program := filepath.Join(t.TempDir(), "program.rb")
+	g.Expect(os.WriteFile(program, []byte("x = 1\ny = x + 1\n"), 0o600)).To(Succeed())
+
+	server := debug.NewServer(func() (*gruby.GRuby, error) { return gruby.New() }, nil)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(serverConn) }()
+
+	client := newDAPClient(clientConn)
+
+	client.send("initialize", map[string]any{"adapterID": "gruby"})
+	g.Expect(client.expect(g, "response", "initialize", nil).Success).To(BeTrue())
+	client.expect(g, "event", "initialized", nil)
+
+	client.send("launch", map[string]any{"program": program})
+	client.expect(g, "response", "launch", nil)
+
+	var breakpoints struct {
+		Breakpoints []struct {
+			Verified bool `json:"verified"`
+			Line     int  `json:"line"`
+		} `json:"breakpoints"`
+	}
+
+	client.send("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []map[string]any{{"line": 2}},
+	})
+	client.expect(g, "response", "setBreakpoints", &breakpoints)
+	g.Expect(breakpoints.Breakpoints).To(HaveLen(1))
+	g.Expect(breakpoints.Breakpoints[0].Verified).To(BeTrue())
+
+	client.send("configurationDone", nil)
+	client.expect(g, "response", "configurationDone", nil)
+
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+
+	client.expect(g, "event", "stopped", &stopped)
+	g.Expect(stopped.Reason).To(Equal("breakpoint"))
+
+	var stackTrace struct {
+		StackFrames []struct {
+			Line int `json:"line"`
+		} `json:"stackFrames"`
+	}
+
+	client.send("stackTrace", map[string]any{"threadId": 1})
+	client.expect(g, "response", "stackTrace", &stackTrace)
+	g.Expect(stackTrace.StackFrames[0].Line).To(Equal(2))
+
+	var variables struct {
+		Variables []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"variables"`
+	}
+
+	client.send("variables", map[string]any{"variablesReference": 1})
+	client.expect(g, "response", "variables", &variables)
+	g.Expect(variables.Variables).To(ContainElement(And(HaveField("Name", "x"), HaveField("Value", "1"))))
+
+	var evaluated struct {
+		Result string `json:"result"`
+	}
+
+	client.send("evaluate", map[string]any{"expression": "x + 41", "frameId": 0})
+	client.expect(g, "response", "evaluate", &evaluated)
+	g.Expect(evaluated.Result).To(Equal("42"))
+
+	client.send("evaluate", map[string]any{"expression": "undefined_method", "frameId": 0})
+	g.Expect(client.expect(g, "response", "evaluate", nil).Success).To(BeFalse())
+
+	client.send("continue", map[string]any{"threadId": 1})
+	client.expect(g, "response", "continue", nil)
+
+	var exited struct {
+		ExitCode int `json:"exitCode"`
+	}
+
+	client.expect(g, "event", "exited", &exited)
+	g.Expect(exited.ExitCode).To(BeZero())
+	client.expect(g, "event", "terminated", nil)
+
+	client.send("disconnect", nil)
+	client.expect(g, "response", "disconnect", nil)
+	g.Eventually(served, time.Second).Should(Receive(BeNil()))
+}
+
+func TestServerMessageTooLarge(t *testing.T) {
+	t.Parallel()
+	g := NewWithT(t)
+
+	server := debug.NewServer(func() (*gruby.GRuby, error) { return gruby.New() }, nil)
+
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader("Content-Length: 1000000000000\r\n\r\n"), io.Discard}
+
+	g.Expect(server.Serve(conn)).To(MatchError(ContainSubstring("message too large")))
+}
@@ -0,0 +1,7 @@
+package gruby
+
+// ProfileTick ticks the profiler like its ticker does, so tests don't depend
+// on timing.
+func (g *GRuby) ProfileTick() {
+	profileTick(g.state)
+}
@@ -0,0 +1,85 @@
+package gruby
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// callDurationBuckets are the upper bounds of the duration histogram published
+// by ExpvarCallObserver.
+var callDurationBuckets = []time.Duration{ //nolint:gochecknoglobals
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// ExpvarCallObserver publishes metrics of the calls of methods defined in Go
+// as an expvar.Map with the given name, and returns the observer collecting
+// them, to be passed to WithCallObserver. The observer may be shared by any
+// number of VMs.
+//
+// The map has an entry per method, named "Class#method" or "Class.method"
+// for class methods, with the "calls", "exceptions" and "duration_ns"
+// counters and a "duration" histogram, its buckets are named after their
+// upper bound, like "le_1ms", and "le_inf".
+//
+// Like expvar.Publish, it panics if the name is already in use.
+func ExpvarCallObserver(name string) CallObserver {
+	metrics := expvar.NewMap(name)
+	lock := sync.Mutex{}
+
+	return func(ev CallEvent) {
+		separator := "#"
+		if ev.ClassMethod {
+			separator = "."
+		}
+
+		key := ev.Class + separator + ev.Method
+
+		lock.Lock()
+		method, ok := metrics.Get(key).(*expvar.Map)
+		if !ok {
+			method = new(expvar.Map).Init()
+			method.Set("duration", new(expvar.Map).Init())
+			metrics.Set(key, method)
+		}
+		lock.Unlock()
+
+		method.Add("calls", 1)
+		method.Add("duration_ns", ev.Duration.Nanoseconds())
+
+		if ev.Exception {
+			method.Add("exceptions", 1)
+		}
+
+		histogram, _ := method.Get("duration").(*expvar.Map)
+		histogram.Add(durationBucket(ev.Duration), 1)
+	}
+}
+
+func durationBucket(duration time.Duration) string {
+	for _, bound := range callDurationBuckets {
+		if duration <= bound {
+			return "le_" + formatBound(bound)
+		}
+	}
+
+	return "le_inf"
+}
+
+func formatBound(bound time.Duration) string {
+	switch {
+	case bound >= time.Second:
+		return strconv.FormatInt(int64(bound/time.Second), 10) + "s"
+	case bound >= time.Millisecond:
+		return strconv.FormatInt(int64(bound/time.Millisecond), 10) + "ms"
+	default:
+		return strconv.FormatInt(int64(bound/time.Microsecond), 10) + "us"
+	}
+}
@@ -0,0 +1,42 @@
+package gruby_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestExpvarCallObserver(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	observer := gruby.ExpvarCallObserver("gruby_test_calls")
+
+	grb := gruby.Must(gruby.New(gruby.WithCallObserver(observer)))
+	defer grb.Close()
+
+	grb.DefineClass("Metered", nil).DefineMethod("answer", testCallback, gruby.ArgsNone())
+
+	_, err := grb.LoadString(`m = Metered.new; m.answer; m.answer`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	var metrics map[string]struct {
+		Calls      int            `json:"calls"`
+		Exceptions int            `json:"exceptions"`
+		Duration   map[string]int `json:"duration"`
+	}
+
+	g.Expect(json.Unmarshal([]byte(expvar.Get("gruby_test_calls").String()), &metrics)).To(Succeed())
+	g.Expect(metrics).To(HaveKey("Metered#answer"))
+	g.Expect(metrics["Metered#answer"].Calls).To(Equal(2))
+	g.Expect(metrics["Metered#answer"].Exceptions).To(BeZero())
+
+	total := 0
+	for _, count := range metrics["Metered#answer"].Duration {
+		total += count
+	}
+	g.Expect(total).To(Equal(2))
+}
@@ -4,6 +4,7 @@ package gruby
 import "C"
 
 import (
+	"strconv"
 	"unsafe"
 )
 
@@ -22,39 +23,83 @@ const (
 // The second return value is an exception, if any. This will be raised.
 type Func func(grb *GRuby, self Value) (Value, Value)
 
-//export goGRBInstanceMethodCall
-func goGRBInstanceMethodCall(state *C.mrb_state, value C.mrb_value) C.mrb_value {
-	return callMethod(state, value, MethodTypeInstance)
-}
+//export goGRBMethodCall
+func goGRBMethodCall(state *C.mrb_state, value C.mrb_value) C.mrb_value {
+	grb := states.get(state)
+	// Get the call info, which we use to lookup the class
+	callInfo := state.c.ci
+
+	// Lookup the class itself, methods of included and prepended modules are
+	// found in include classes.
+	class := C._go_mrb_method_owner(*(**C.struct_RClass)(unsafe.Pointer(&callInfo.u[0])))
+
+	// The method carries the handle of its Go function, whatever the name
+	// it is called with.
+	method, ok := grb.handle(grb.value(C._go_mrb_proc_handle(state))).(goMethod)
+	if !ok {
+		name := C.GoString(C._go_mrb_sym_name(state, callInfo.mid))
+		exc := grb.newError(grb.Class("NoMethodError", nil), "undefined Go method '"+name+"'")
+		state.exc = C._go_mrb_getobj(exc.CValue())
+
+		return grb.NilValue().CValue()
+	}
+
+	if exc := argumentError(grb, method.spec); exc != nil {
+		state.exc = C._go_mrb_getobj(exc.CValue())
+
+		return grb.NilValue().CValue()
+	}
 
-//export goGRBClassMethodCall
-func goGRBClassMethodCall(state *C.mrb_state, value C.mrb_value) C.mrb_value {
-	return callMethod(state, value, MethodTypeClass)
+	return callGoMethod(grb, class, method, value)
 }
 
-func callMethod(state *C.mrb_state, value C.mrb_value, methodType MethodType) C.mrb_value {
-	grb := states.get(state)
-	// Get the call info, which we use to lookup the proc
-	callInfo := state.c.ci
+// argumentError checks the number of arguments of a call against the spec
+// of the method, mruby only checks it for methods taking none.
+func argumentError(grb *GRuby, spec ArgSpec) Value {
+	given := int(C._go_mrb_get_argc(grb.state))
+	required := int(C._go_MRB_ASPEC_REQ(C.mrb_aspec(spec)))
+	optional := int(C._go_MRB_ASPEC_OPT(C.mrb_aspec(spec)))
+	rest := C._go_MRB_ASPEC_REST(C.mrb_aspec(spec)) != 0
+
+	if given >= required && (rest || given <= required+optional) {
+		return nil
+	}
 
-	// Lookup the class itself
-	class := *(**C.struct_RClass)(unsafe.Pointer(&callInfo.u[0]))
+	expected := strconv.Itoa(required)
 
-	var method Func
-	if methodType == MethodTypeInstance {
-		method = grb.instanceMethods.get(class, callInfo.mid)
-	} else {
-		method = grb.classMethods.get(class, callInfo.mid)
+	switch {
+	case rest:
+		expected += "+"
+	case optional > 0:
+		expected += ".." + strconv.Itoa(required+optional)
 	}
 
-	result, exc := method(grb, grb.value(value))
+	message := "wrong number of arguments (given " + strconv.Itoa(given) + ", expected " + expected + ")"
+
+	return grb.newError(grb.Class("ArgumentError", nil), message)
+}
+
+// callGoMethod calls the Go function of a method or a proc, if the
+// capabilities it requires are granted, and reports the call to the call
+// observers.
+func callGoMethod(grb *GRuby, class *C.struct_RClass, method goMethod, value C.mrb_value) C.mrb_value {
+	var result, exc Value
+
+	switch {
+	case !grb.capabilities.allow(method.capabilities):
+		exc = grb.capabilityError(grb.state.c.ci.mid, method.capabilities)
+	case len(grb.callObservers) == 0:
+		result, exc = method.fn(grb, grb.value(value))
+	default:
+		result, exc = grb.observeCall(class, method.methodType, method.fn, grb.value(value))
+	}
 
 	if result == nil {
 		result = grb.NilValue()
 	}
 
 	if exc != nil {
-		state.exc = C._go_mrb_getobj(exc.CValue())
+		grb.state.exc = C._go_mrb_getobj(exc.CValue())
 		return grb.NilValue().CValue()
 	}
 
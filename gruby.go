@@ -1,12 +1,15 @@
 package gruby
 
-// #cgo CFLAGS: -Imruby-build/mruby/include
+// #cgo CFLAGS: -Imruby-build/mruby/include -DMRB_USE_DEBUG_HOOK
 // #cgo LDFLAGS: ${SRCDIR}/libmruby.a -lm
 // #include "gruby.h"
 import "C"
 
 import (
+	"errors"
+	"io"
 	"strings"
+	"sync"
 	"unsafe"
 )
 
@@ -22,8 +25,23 @@ type GRuby struct {
 	loadedFiles       map[string]bool
 	getArgAccumulator Values
 
-	instanceMethods methodsStore
-	classMethods    methodsStore
+	traceListeners    map[int]traceListener
+	nextTraceListener int
+	removeTraceHook   func()
+	coverage          *coverage
+	profiler          *profiler
+	callObservers     []CallObserver
+	capabilities      *Capabilities
+	checkpoint        *checkpoint
+	stdout            io.Writer
+	stderr            io.Writer
+	outputInstalled   bool
+	handles           map[int]any
+	nextHandle        int
+	channelClassV     *Class
+	futureClassV      *Class
+	releasedProcs     []Value
+	releasedProcsMu   sync.Mutex
 
 	trueV  Value
 	falseV Value
@@ -65,23 +83,30 @@ type ArenaIndex int
 // by calling the Close method.
 func New(mutators ...Mutator) (*GRuby, error) {
 	grb := &GRuby{
-		state:       C.mrb_open(),
-		loadedFiles: map[string]bool{},
-		instanceMethods: methodsStore{
-			grb:     nil,
-			classes: classMethodMap{},
-		},
-		classMethods: methodsStore{
-			grb:     nil,
-			classes: classMethodMap{},
-		},
+		state:             C.mrb_open(),
+		loadedFiles:       map[string]bool{},
 		getArgAccumulator: make(Values, 0, C._go_get_max_funcall_args()),
+		traceListeners:    map[int]traceListener{},
+		nextTraceListener: 0,
+		removeTraceHook:   nil,
+		coverage:          nil,
+		profiler:          nil,
+		callObservers:     nil,
+		capabilities:      nil,
+		checkpoint:        nil,
+		stdout:            nil,
+		stderr:            nil,
+		outputInstalled:   false,
+		handles:           map[int]any{},
+		nextHandle:        1,
+		channelClassV:     nil,
+		futureClassV:      nil,
+		releasedProcs:     nil,
+		releasedProcsMu:   sync.Mutex{},
 		trueV:             nil,
 		falseV:            nil,
 		nilV:              nil,
 	}
-	grb.instanceMethods.grb = grb
-	grb.classMethods.grb = grb
 	grb.trueV = grb.value(C.mrb_true_value())
 	grb.falseV = grb.value(C.mrb_false_value())
 	grb.nilV = grb.value(C.mrb_nil_value())
@@ -181,6 +206,9 @@ func (g *GRuby) Module(name string) *Class {
 // should only be called once.
 func (g *GRuby) Close() {
 	states.delete(g)
+	// The profiler's ticker uses the tracing state.
+	g.StopProfiler()
+	C._go_trace_free(g.state)
 	C.mrb_close(g.state)
 }
 
@@ -201,8 +229,10 @@ func (g *GRuby) ConstDefined(name string, scope Value) bool {
 	return C._go_mrb_bool2int(b) != 0
 }
 
-// FullGC executes a complete GC cycle on the VM.
+// FullGC executes a complete GC cycle on the VM, including the procs of the
+// garbage collected functions returned by ProcToFunc.
 func (g *GRuby) FullGC() {
+	g.unregisterReleasedProcs()
 	C.mrb_full_gc(g.state)
 }
 
@@ -266,7 +296,7 @@ func (g *GRuby) LoadStringWithContext(code string, ctx *CompileContext) (Value,
 	* mrb_gc_arena_restore(mrb, ai);
 	 */
 
-	value := C.mrb_load_string_cxt(g.state, cstr, ctx.ctx)
+	value := C._go_mrb_load_string_cxt(g.state, cstr, ctx.ctx)
 	if exc := checkException(g); exc != nil {
 		return nil, exc
 	}
@@ -485,6 +515,23 @@ func (g *GRuby) LoadFile(path string, content string) (bool, *CompileContext, er
 	return true, ctx, nil
 }
 
+// symbol returns the symbol with the given name.
+func (g *GRuby) symbol(name string) Value {
+	cstr := C.CString(name)
+	defer freeStr(cstr)
+
+	return g.value(C.mrb_symbol_value(C.mrb_intern_cstr(g.state, cstr)))
+}
+
+// newString creates a Ruby string from the bytes of s, which may contain NUL
+// bytes unlike C strings.
+func (g *GRuby) newString(s string) Value {
+	cstr := C.CString(s)
+	defer freeStr(cstr)
+
+	return g.value(C.mrb_str_new(g.state, cstr, C.mrb_int(len(s))))
+}
+
 func (g *GRuby) value(v C.mrb_value) Value {
 	return &GValue{
 		grb:   g,
@@ -492,21 +539,42 @@ func (g *GRuby) value(v C.mrb_value) Value {
 	}
 }
 
-func (g *GRuby) insertInstanceMethod(class *C.struct_RClass, name string, callback Func) {
-	g.instanceMethods.add(class, name, callback)
-}
-
-func (g *GRuby) insertClassMethod(class *C.struct_RClass, name string, callback Func) {
-	g.classMethods.add(class, name, callback)
-}
-
 func checkException(grb *GRuby) error {
 	if grb.state.exc == nil {
 		return nil
 	}
 
 	err := newExceptionValue(grb)
+	grb.traceUncaughtException(err)
 	grb.state.exc = nil
 
 	return err
 }
+
+// newError creates an exception of the given class, a Func returns it to
+// raise it.
+func (g *GRuby) newError(class *Class, message string) Value {
+	exc, err := class.New(MustToRuby(g, message))
+	if err != nil {
+		// The exception must be raised whatever happens, otherwise the call
+		// would succeed.
+		var excErr *ExceptionError
+		if errors.As(err, &excErr) {
+			return excErr.Value
+		}
+
+		panic(err)
+	}
+
+	return exc
+}
+
+// errorClass returns the exception class with the given name, defining it as
+// a subclass of super if the VM does not, some are only defined by gems.
+func (g *GRuby) errorClass(name string, super string) *Class {
+	if g.ConstDefined(name, g.ObjectClass()) {
+		return g.Class(name, nil)
+	}
+
+	return g.DefineClass(name, g.Class(super, nil))
+}
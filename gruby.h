@@ -10,13 +10,18 @@
 
 #include <stdlib.h>
 #include <errno.h>
+#include <string.h>
 #include <mruby.h>
 #include <mruby/array.h>
 #include <mruby/class.h>
 #include <mruby/compile.h>
+#include <mruby/data.h>
+#include <mruby/debug.h>
+#include <mruby/dump.h>
 #include <mruby/error.h>
 #include <mruby/irep.h>
 #include <mruby/gc.h>
+#include <mruby/opcode.h>
 #include <mruby/hash.h>
 #include <mruby/proc.h>
 #include <mruby/string.h>
@@ -35,16 +40,348 @@
 //-------------------------------------------------------------------
 // Helpers to deal with calling back into Go.
 //-------------------------------------------------------------------
-extern mrb_value goGRBInstanceMethodCall(mrb_state *, mrb_value);
-static inline mrb_func_t _go_grb_instance_method_call_t()
+// Methods defined from Go are C function procs carrying the handle of their
+// Go function in their env, so aliases and copies of them call the same Go
+// function.
+extern mrb_value goGRBMethodCall(mrb_state *, mrb_value);
+static inline void _go_mrb_define_go_method(mrb_state *mrb, struct RClass *c, const char *name, mrb_value handle, mrb_aspec aspec)
 {
-  return &goGRBInstanceMethodCall;
+  struct RProc *proc = mrb_proc_new_cfunc_with_env(mrb, &goGRBMethodCall, 1, &handle);
+  mrb_method_t m;
+
+  MRB_METHOD_FROM_PROC(m, proc);
+  if (aspec == MRB_ARGS_NONE())
+  {
+    MRB_METHOD_NOARG_SET(m);
+  }
+
+  mrb_define_method_raw(mrb, c, mrb_intern_cstr(mrb, name), m);
 }
 
-extern mrb_value goGRBClassMethodCall(mrb_state *, mrb_value);
-static inline mrb_func_t _go_grb_class_method_call_t()
+// Returns the class or module a method found in c belongs to. Modules are
+// included through include classes, and the methods of a class with
+// prepended modules are moved to its origin, an include class too.
+static inline struct RClass *_go_mrb_method_owner(struct RClass *c)
 {
-  return &goGRBClassMethodCall;
+  if (c->tt == MRB_TT_ICLASS)
+  {
+    return c->c;
+  }
+
+  return c;
+}
+
+// Handles are data objects referencing Go values by id, the Go value is
+// forgotten when the handle is collected.
+extern void goHandleFree(mrb_state *, mrb_int);
+static void _go_handle_free(mrb_state *mrb, void *p)
+{
+  goHandleFree(mrb, (mrb_int)(intptr_t)p);
+}
+
+static const struct mrb_data_type _go_handle_type = {"GRuby::Handle", _go_handle_free};
+
+static inline mrb_value _go_mrb_handle_new(mrb_state *mrb, mrb_int id)
+{
+  struct RData *data = mrb_data_object_alloc(mrb, mrb->object_class, (void *)(intptr_t)id, &_go_handle_type);
+
+  return mrb_obj_value(data);
+}
+
+static inline mrb_int _go_mrb_handle_id(mrb_state *mrb, mrb_value value)
+{
+  // Each file including this header has its own _go_handle_type, so the type
+  // is compared by name.
+  if (!mrb_data_p(value) || DATA_TYPE(value) == NULL || strcmp(DATA_TYPE(value)->struct_name, _go_handle_type.struct_name) != 0)
+  {
+    return -1;
+  }
+
+  return (mrb_int)(intptr_t)DATA_PTR(value);
+}
+
+// Procs created from Go carry the handle of their Go function in their env.
+extern mrb_value goGRBProcCall(mrb_state *, mrb_value);
+static inline mrb_value _go_mrb_proc_new(mrb_state *mrb, mrb_value handle, int lambda)
+{
+  struct RProc *proc = mrb_proc_new_cfunc_with_env(mrb, &goGRBProcCall, 1, &handle);
+
+  if (lambda)
+  {
+    proc->flags |= MRB_PROC_STRICT;
+  }
+
+  return mrb_obj_value(proc);
+}
+
+static inline mrb_value _go_mrb_proc_handle(mrb_state *mrb)
+{
+  return mrb_proc_cfunc_env_get(mrb, 0);
+}
+
+//-------------------------------------------------------------------
+// Helpers to deal with tracing.
+//-------------------------------------------------------------------
+// The code fetch hook is called for every VM instruction, calling into Go
+// that often would make tracing unbearably slow, so the hook filters the
+// instructions and only calls Go when something interesting happens.
+// These must match the TraceEventType constants in trace.go.
+#define GO_TRACE_LINE 0
+#define GO_TRACE_CALL 1
+#define GO_TRACE_RETURN 2
+#define GO_TRACE_RAISE 3
+
+// This is declared in trace.go.
+extern void goTraceEvent(mrb_state *, int, mrb_irep *, int, mrb_value *);
+// This is declared in profiler.go.
+extern void goProfileSample(mrb_state *, mrb_irep *, int, int);
+
+// Tracing state, stored in mrb->ud while the VM is alive.
+typedef struct
+{
+  const mrb_irep *irep;
+  int32_t line;
+  struct RObject *exc;
+  int in_hook;
+  // Incremented by the profiler's ticker, from another thread.
+  int samples;
+  // The depth of the calls into the VM, ticks are ignored while it is idle.
+  int running;
+} _go_trace_state;
+
+static inline int _go_trace_method_frame(mrb_callinfo *ci)
+{
+  return ci->mid != 0 && ci->proc != NULL && MRB_PROC_SCOPE_P(ci->proc) && MRB_PROC_STRICT_P(ci->proc);
+}
+
+static void _go_code_fetch_hook(mrb_state *mrb, const mrb_irep *irep, const mrb_code *pc, mrb_value *regs)
+{
+  _go_trace_state *st = (_go_trace_state *)mrb->ud;
+
+  // Go callbacks may run Ruby code, which must not be traced.
+  if (st == NULL || st->in_hook)
+  {
+    return;
+  }
+  st->in_hook = 1;
+
+  int offset = (int)(pc - irep->iseq);
+  int method_frame = _go_trace_method_frame(mrb->c->ci);
+
+  int samples = __atomic_exchange_n(&st->samples, 0, __ATOMIC_ACQ_REL);
+  if (samples > 0)
+  {
+    goProfileSample(mrb, (mrb_irep *)irep, offset, samples);
+  }
+
+  // The first instruction executed after an exception was raised, usually
+  // in a rescue or ensure clause.
+  if (mrb->exc != NULL && mrb->exc != st->exc)
+  {
+    st->exc = mrb->exc;
+    goTraceEvent(mrb, GO_TRACE_RAISE, (mrb_irep *)irep, offset, regs);
+  }
+  else if (mrb->exc == NULL)
+  {
+    st->exc = NULL;
+  }
+
+  if (method_frame && offset == 0)
+  {
+    goTraceEvent(mrb, GO_TRACE_CALL, (mrb_irep *)irep, offset, regs);
+  }
+
+  // A new run of the irep reports its first line even if the last event was
+  // on the same line, like for a one-line block called again and again from
+  // a method without debug info.
+  if (offset == 0)
+  {
+    st->irep = NULL;
+    st->line = -1;
+  }
+
+  int32_t line = mrb_debug_get_line(mrb, irep, (uint32_t)offset);
+  if (line >= 0 && (irep != st->irep || line != st->line))
+  {
+    st->irep = irep;
+    st->line = line;
+    goTraceEvent(mrb, GO_TRACE_LINE, (mrb_irep *)irep, offset, regs);
+  }
+
+  if (method_frame && (*pc == OP_RETURN || *pc == OP_RETURN_BLK))
+  {
+    goTraceEvent(mrb, GO_TRACE_RETURN, (mrb_irep *)irep, offset, regs);
+  }
+
+  st->in_hook = 0;
+}
+
+static inline void _go_trace_enable(mrb_state *mrb)
+{
+  if (mrb->ud == NULL)
+  {
+    mrb->ud = calloc(1, sizeof(_go_trace_state));
+  }
+
+  _go_trace_state *st = (_go_trace_state *)mrb->ud;
+  st->irep = NULL;
+  st->line = -1;
+  st->exc = mrb->exc;
+  __atomic_store_n(&st->samples, 0, __ATOMIC_RELEASE);
+
+  mrb->code_fetch_hook = _go_code_fetch_hook;
+}
+
+static inline void _go_trace_disable(mrb_state *mrb)
+{
+  mrb->code_fetch_hook = NULL;
+}
+
+// The state is not freed on disable as the hook may be disabled from within
+// a Go callback, while the hook still uses it.
+static inline void _go_trace_free(mrb_state *mrb)
+{
+  mrb->code_fetch_hook = NULL;
+  free(mrb->ud);
+  mrb->ud = NULL;
+}
+
+// Returns 1 if the current exception was not reported by the hook yet, which
+// happens when it is not rescued in Ruby, and marks it as reported.
+static inline int _go_trace_take_exc(mrb_state *mrb)
+{
+  _go_trace_state *st = (_go_trace_state *)mrb->ud;
+  if (st == NULL || mrb->exc == NULL || mrb->exc == st->exc)
+  {
+    return 0;
+  }
+
+  st->exc = mrb->exc;
+  return 1;
+}
+
+// Asks the hook to take a sample on the next instruction. It may be called
+// from any thread, as long as tracing is enabled. Ticks while the VM is idle,
+// between two calls into it, are dropped, they would all be charged to the
+// next instruction.
+static inline void _go_profile_tick(mrb_state *mrb)
+{
+  _go_trace_state *st = (_go_trace_state *)mrb->ud;
+  if (st != NULL && __atomic_load_n(&st->running, __ATOMIC_ACQUIRE) > 0)
+  {
+    __atomic_add_fetch(&st->samples, 1, __ATOMIC_ACQ_REL);
+  }
+}
+
+// Called around every call into the VM, including the nested ones made from
+// Go methods.
+static inline void _go_vm_enter(mrb_state *mrb)
+{
+  _go_trace_state *st = (_go_trace_state *)mrb->ud;
+  if (st != NULL)
+  {
+    __atomic_add_fetch(&st->running, 1, __ATOMIC_ACQ_REL);
+  }
+}
+
+static inline void _go_vm_leave(mrb_state *mrb)
+{
+  _go_trace_state *st = (_go_trace_state *)mrb->ud;
+  if (st != NULL && __atomic_load_n(&st->running, __ATOMIC_ACQUIRE) > 0 &&
+      __atomic_sub_fetch(&st->running, 1, __ATOMIC_ACQ_REL) == 0)
+  {
+    // Drop the ticks not taken by the hook before returning.
+    __atomic_store_n(&st->samples, 0, __ATOMIC_RELEASE);
+  }
+}
+
+typedef struct
+{
+  const char *file;
+  int32_t line;
+  const char *method;
+  const char *class_name;
+  int block;
+} _go_profile_frame;
+
+// Fills frames with the Ruby frames of the call stack, the innermost first,
+// and returns their number. irep and offset are where the VM currently is,
+// the pc saved in the top callinfo is stale.
+static inline int _go_profile_walk(mrb_state *mrb, const mrb_irep *irep, int offset, _go_profile_frame *frames, int max)
+{
+  int n = 0;
+
+  for (mrb_callinfo *ci = mrb->c->ci; ci >= mrb->c->cibase && n < max; ci--)
+  {
+    const struct RProc *proc = ci->proc;
+    if (proc == NULL || MRB_PROC_CFUNC_P(proc))
+    {
+      continue;
+    }
+
+    const mrb_irep *ci_irep = proc->body.irep;
+    uint32_t idx;
+    if (ci == mrb->c->ci)
+    {
+      ci_irep = irep;
+      idx = (uint32_t)offset;
+    }
+    else
+    {
+      if (ci->pc == NULL)
+      {
+        continue;
+      }
+
+      // The saved pc points after the call instruction.
+      idx = (uint32_t)(ci->pc - ci_irep->iseq);
+      if (idx > 0)
+      {
+        idx--;
+      }
+    }
+
+    frames[n].file = mrb_debug_get_filename(mrb, ci_irep, idx);
+    frames[n].line = mrb_debug_get_line(mrb, ci_irep, idx);
+    frames[n].method = ci->mid ? mrb_sym_name(mrb, ci->mid) : NULL;
+    frames[n].class_name = mrb_obj_classname(mrb, ci->stack[0]);
+    frames[n].block = ci->mid != 0 && !MRB_PROC_SCOPE_P(proc);
+    n++;
+  }
+
+  return n;
+}
+
+// Accessors used to walk the ireps of loaded code, see coverage.go.
+static inline uint32_t _go_irep_ilen(const mrb_irep *irep)
+{
+  return irep->ilen;
+}
+
+static inline int _go_irep_rlen(const mrb_irep *irep)
+{
+  return irep->rlen;
+}
+
+static inline mrb_irep *_go_irep_rep(const mrb_irep *irep, int i)
+{
+  return (mrb_irep *)irep->reps[i];
+}
+
+// Returns the depth of the call stack of the current fiber.
+static inline int _go_mrb_ci_depth(mrb_state *mrb)
+{
+  return (int)(mrb->c->ci - mrb->c->cibase);
+}
+
+static inline const char *_go_mrb_sym_name(mrb_state *mrb, mrb_sym sym)
+{
+  if (sym == 0)
+  {
+    return NULL;
+  }
+
+  return mrb_sym_name(mrb, sym);
 }
 
 //-------------------------------------------------------------------
@@ -58,6 +395,7 @@ static inline mrb_func_t _go_grb_class_method_call_t()
   struct mrb_jmpbuf *prev_jmp = mrb->jmp; \
   struct mrb_jmpbuf c_jmp;                \
   mrb_value result = mrb_nil_value();     \
+  _go_vm_enter(mrb);                      \
   MRB_TRY(&c_jmp)                         \
   {                                       \
     mrb->jmp = &c_jmp;
@@ -71,6 +409,7 @@ static inline mrb_func_t _go_grb_class_method_call_t()
     result = mrb_nil_value();   \
   }                             \
   MRB_END_EXC(&c_jmp);          \
+  _go_vm_leave(mrb);            \
   mrb_gc_protect(mrb, result);  \
   return result;
 
@@ -81,6 +420,20 @@ static mrb_value _go_mrb_load_string(mrb_state *mrb, const char *s)
   GOMRUBY_EXC_PROTECT_END
 }
 
+static mrb_value _go_mrb_load_string_cxt(mrb_state *mrb, const char *s, mrbc_context *cxt)
+{
+  GOMRUBY_EXC_PROTECT_START
+  result = mrb_load_string_cxt(mrb, s, cxt);
+  GOMRUBY_EXC_PROTECT_END
+}
+
+static mrb_value _go_mrb_load_irep_buf(mrb_state *mrb, const void *buf, size_t size)
+{
+  GOMRUBY_EXC_PROTECT_START
+  result = mrb_load_irep_buf(mrb, buf, size);
+  GOMRUBY_EXC_PROTECT_END
+}
+
 static mrb_value _go_mrb_yield_argv(mrb_state *mrb, mrb_value b, mrb_int argc, const mrb_value *argv)
 {
   GOMRUBY_EXC_PROTECT_START
@@ -88,6 +441,23 @@ static mrb_value _go_mrb_yield_argv(mrb_state *mrb, mrb_value b, mrb_int argc, c
   GOMRUBY_EXC_PROTECT_END
 }
 
+// _go_mrb_run_under runs a top-level proc with the given self, defining
+// methods and constants in target, like a block passed to class_exec. It runs
+// a copy of the proc, so the proc keeps its own target class.
+static mrb_value _go_mrb_run_under(mrb_state *mrb, mrb_value proc, mrb_value self, struct RClass *target)
+{
+  GOMRUBY_EXC_PROTECT_START
+  struct RProc *copy = (struct RProc *)mrb_obj_alloc(mrb, MRB_TT_PROC, mrb->proc_class);
+  mrb_proc_copy(mrb, copy, mrb_proc_ptr(proc));
+  // The env of a block is shared with the procs created along with it.
+  if (!MRB_PROC_ENV_P(copy))
+  {
+    MRB_PROC_SET_TARGET_CLASS(copy, target);
+  }
+  result = mrb_yield_with_class(mrb, mrb_obj_value(copy), 0, NULL, self, target);
+  GOMRUBY_EXC_PROTECT_END
+}
+
 static mrb_value _go_mrb_call(mrb_state *mrb, mrb_value b, mrb_sym method, mrb_int argc, const mrb_value *argv, mrb_value *block)
 {
   GOMRUBY_EXC_PROTECT_START
@@ -102,6 +472,150 @@ static mrb_value _go_mrb_call(mrb_state *mrb, mrb_value b, mrb_sym method, mrb_i
   GOMRUBY_EXC_PROTECT_END
 }
 
+// These change the ancestors and the methods of classes, they raise on cyclic
+// includes or unknown methods.
+static mrb_value _go_mrb_include_module(mrb_state *mrb, struct RClass *c, struct RClass *m)
+{
+  GOMRUBY_EXC_PROTECT_START
+  mrb_include_module(mrb, c, m);
+  GOMRUBY_EXC_PROTECT_END
+}
+
+static mrb_value _go_mrb_prepend_module(mrb_state *mrb, struct RClass *c, struct RClass *m)
+{
+  GOMRUBY_EXC_PROTECT_START
+  mrb_prepend_module(mrb, c, m);
+  GOMRUBY_EXC_PROTECT_END
+}
+
+// Checkpoints record the methods defined in classes themselves, and the
+// links to their ancestors where modules are included or prepended, to put
+// them back on reset. The methods of a class with prepended modules live in
+// its origin, where modules are included after.
+static inline int _go_mrb_own_method(mrb_state *mrb, struct RClass *c, mrb_sym mid, mrb_method_t *m)
+{
+  struct RClass *origin = c;
+  struct RClass *owner;
+
+  MRB_CLASS_ORIGIN(origin);
+  owner = origin;
+  *m = mrb_method_search_vm(mrb, &owner, mid);
+
+  return !MRB_METHOD_UNDEF_P(*m) && owner == origin;
+}
+
+// Returns the proc of a method, nil for methods implemented in C.
+static inline mrb_value _go_mrb_method_proc(mrb_method_t m)
+{
+  if (MRB_METHOD_UNDEF_P(m) || MRB_METHOD_FUNC_P(m))
+  {
+    return mrb_nil_value();
+  }
+
+  return mrb_obj_value((struct RProc *)MRB_METHOD_PROC(m));
+}
+
+static inline mrb_bool _go_mrb_method_eq(mrb_method_t a, mrb_method_t b)
+{
+  if (MRB_METHOD_FUNC_P(a) != MRB_METHOD_FUNC_P(b))
+  {
+    return FALSE;
+  }
+
+#ifdef MRB_METHOD_VISIBILITY
+  if (MRB_METHOD_VISIBILITY(a) != MRB_METHOD_VISIBILITY(b))
+  {
+    return FALSE;
+  }
+#endif
+
+  if (MRB_METHOD_FUNC_P(a))
+  {
+    return MRB_METHOD_FUNC(a) == MRB_METHOD_FUNC(b);
+  }
+
+  return MRB_METHOD_PROC(a) == MRB_METHOD_PROC(b);
+}
+
+// Defines the method again if it was redefined or removed since it was
+// recorded. Frozen classes raise, so unchanged methods are left alone.
+static mrb_value _go_mrb_restore_method(mrb_state *mrb, struct RClass *c, mrb_sym mid, mrb_method_t m)
+{
+  mrb_method_t current;
+  if (_go_mrb_own_method(mrb, c, mid, &current) && _go_mrb_method_eq(current, m))
+  {
+    return mrb_nil_value();
+  }
+
+  GOMRUBY_EXC_PROTECT_START
+  mrb_define_method_raw(mrb, c, mid, m);
+  GOMRUBY_EXC_PROTECT_END
+}
+
+static inline struct RClass *_go_mrb_class_origin(struct RClass *c)
+{
+  MRB_CLASS_ORIGIN(c);
+  return c;
+}
+
+static inline struct RClass *_go_mrb_class_super(struct RClass *c)
+{
+  return c->super;
+}
+
+// Unlinks the modules included in or prepended to c since its links were
+// recorded. It fails if c got its first prepended module since, its methods
+// were moved to a new origin then.
+static inline int _go_mrb_restore_ancestors(mrb_state *mrb, struct RClass *c, struct RClass *origin, struct RClass *super, struct RClass *origin_super)
+{
+  if (_go_mrb_class_origin(c) != origin)
+  {
+    return FALSE;
+  }
+
+  if (c->super == super && origin->super == origin_super)
+  {
+    return TRUE;
+  }
+
+  c->super = super;
+  origin->super = origin_super;
+
+#ifndef MRB_NO_METHOD_CACHE
+  memset(mrb->cache, 0, sizeof(mrb->cache));
+#endif
+
+  return TRUE;
+}
+
+static mrb_value _go_mrb_extend_object(mrb_state *mrb, mrb_value obj, struct RClass *m)
+{
+  GOMRUBY_EXC_PROTECT_START
+  mrb_include_module(mrb, mrb_singleton_class_ptr(mrb, obj), m);
+  GOMRUBY_EXC_PROTECT_END
+}
+
+static mrb_value _go_mrb_define_alias(mrb_state *mrb, struct RClass *c, const char *name, const char *old)
+{
+  GOMRUBY_EXC_PROTECT_START
+  mrb_define_alias(mrb, c, name, old);
+  GOMRUBY_EXC_PROTECT_END
+}
+
+static mrb_value _go_mrb_undef_method(mrb_state *mrb, struct RClass *c, const char *name)
+{
+  GOMRUBY_EXC_PROTECT_START
+  mrb_undef_method(mrb, c, name);
+  GOMRUBY_EXC_PROTECT_END
+}
+
+static mrb_value _go_mrb_remove_method(mrb_state *mrb, struct RClass *c, const char *name)
+{
+  GOMRUBY_EXC_PROTECT_START
+  mrb_remove_method(mrb, c, mrb_intern_cstr(mrb, name));
+  GOMRUBY_EXC_PROTECT_END
+}
+
 //-------------------------------------------------------------------
 // Helpers to deal with getting arguments
 //-------------------------------------------------------------------
@@ -147,6 +661,18 @@ static inline const char *_go_mrb_calc_send(const char *s)
   return s + strlen(s);
 }
 
+// Dumps the irep of the proc into the .mrb binary format. The buffer is
+// allocated with mrb_malloc and must be freed with mrb_free.
+static inline int _go_mrb_dump_proc(mrb_state *mrb, struct RProc *proc, uint8_t **bin, size_t *bin_size)
+{
+  if (MRB_PROC_CFUNC_P(proc))
+  {
+    return MRB_DUMP_INVALID_IREP;
+  }
+
+  return mrb_dump_irep(mrb, proc->body.irep, MRB_DUMP_DEBUG_INFO, bin, bin_size);
+}
+
 // Sets the capture_errors field on mrb_parser_state. Go can't access bit
 // fields.
 static inline void
@@ -190,6 +716,33 @@ static inline mrb_aspec _go_MRB_ARGS_REQ(int n)
   return MRB_ARGS_REQ(n);
 }
 
+static inline int _go_MRB_ASPEC_REQ(mrb_aspec a)
+{
+  return MRB_ASPEC_REQ(a) + MRB_ASPEC_POST(a);
+}
+
+static inline int _go_MRB_ASPEC_OPT(mrb_aspec a)
+{
+  return MRB_ASPEC_OPT(a);
+}
+
+static inline int _go_MRB_ASPEC_REST(mrb_aspec a)
+{
+  return MRB_ASPEC_REST(a);
+}
+
+// Returns the number of arguments of the call, without the block. Keywords
+// count as a hash, like for GetArgs.
+static inline mrb_int _go_mrb_get_argc(mrb_state *mrb)
+{
+  const mrb_value *argv;
+  mrb_int argc;
+
+  mrb_get_args(mrb, "*!", &argv, &argc);
+
+  return argc;
+}
+
 static inline float _go_mrb_float(mrb_value o)
 {
   return mrb_float(o);
@@ -285,9 +838,26 @@ static inline void _go_mrb_context_set_capture_errors(struct mrbc_context *ctx,
   }
 }
 
+static inline int _go_mrb_context_no_exec(struct mrbc_context *ctx)
+{
+  return ctx->no_exec;
+}
+
+static inline void _go_mrb_context_set_no_exec(struct mrbc_context *ctx, int state)
+{
+  ctx->no_exec = FALSE;
+
+  if (state != 0)
+  {
+    ctx->no_exec = TRUE;
+  }
+}
+
 static inline mrb_value _go_mrb_vm_run(mrb_state *m, struct RProc *proc, mrb_value self, int *stack_keep)
 {
+  _go_vm_enter(m);
   mrb_value result = mrb_vm_run(m, proc, self, *stack_keep);
+  _go_vm_leave(m);
   *stack_keep = proc->body.irep->nlocals;
   return result;
 }
@@ -347,4 +917,9 @@ static inline char *_go_RSTRING_PTR(mrb_value val)
   return RSTRING_PTR(val);
 }
 
+static inline mrb_int _go_RSTRING_LEN(mrb_value val)
+{
+  return RSTRING_LEN(val);
+}
+
 #endif
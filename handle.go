@@ -0,0 +1,37 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+// newHandle returns a Ruby object referencing a Go value, so Ruby objects
+// holding it in a hidden instance variable can find the Go value back. The
+// Go value is forgotten when the handle is garbage collected.
+func (g *GRuby) newHandle(value any) Value {
+	id := g.nextHandle
+	g.nextHandle++
+	g.handles[id] = value
+
+	return g.value(C._go_mrb_handle_new(g.state, C.mrb_int(id)))
+}
+
+// handle returns the Go value referenced by a handle, nil if v isn't a
+// handle.
+func (g *GRuby) handle(v Value) any {
+	id := C._go_mrb_handle_id(g.state, v.CValue())
+	if id < 0 {
+		return nil
+	}
+
+	return g.handles[int(id)]
+}
+
+//export goHandleFree
+func goHandleFree(state *C.mrb_state, id C.mrb_int) {
+	// The VM is being closed, its handles go with it.
+	grb := states.get(state)
+	if grb == nil {
+		return
+	}
+
+	delete(grb.handles, int(id))
+}
@@ -0,0 +1,408 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// jsonMaxNesting is the maximum depth of the objects JSON.generate encodes,
+// it stops on recursive structures, and of the documents JSON.parse decodes.
+const jsonMaxNesting = 100
+
+var (
+	errJSONTrailingData = errors.New("unexpected data after the JSON value")
+	errJSONTooDeep      = errors.New("nesting is too deep")
+	errJSONNotAllowed   = errors.New("not allowed in JSON")
+)
+
+// WithJSON returns a Mutator defining the JSON module, implemented in Go so it
+// is available whatever gems mruby is built with:
+//
+//	JSON.parse('{"name": "alice"}', symbolize_names: true) # => {name: "alice"}
+//	JSON.generate({name: "alice"}, pretty: true)
+//
+// JSON.parse raises JSON::ParserError for invalid documents, and
+// JSON::NestingError for documents nested deeper than 100 arrays or objects.
+// JSON.generate raises JSON::GeneratorError for values JSON can't represent,
+// like NaN.
+// Hash keys are converted to strings and objects other than nil, booleans,
+// numbers, strings, symbols, arrays and hashes are generated with to_s.
+func WithJSON() Mutator {
+	return func(grb *GRuby) error {
+		module := grb.DefineModule("JSON")
+		jsonError := grb.DefineClassUnder("JSONError", grb.Class("StandardError", nil), module)
+		parserError := grb.DefineClassUnder("ParserError", jsonError, module)
+		nestingError := grb.DefineClassUnder("NestingError", parserError, module)
+		generatorError := grb.DefineClassUnder("GeneratorError", jsonError, module)
+
+		module.DefineClassMethod("parse", func(grb *GRuby, self Value) (Value, Value) {
+			source, options, exc := jsonArgs(grb)
+			if exc != nil {
+				return nil, exc
+			}
+
+			if source.Type() != TypeString {
+				message := "no implicit conversion of " + source.Class().String() + " into String"
+
+				return nil, grb.newError(grb.Class("TypeError", nil), message)
+			}
+
+			value, err := parseJSON(grb, source.String(), jsonOption(grb, options, "symbolize_names"))
+			if errors.Is(err, errJSONTooDeep) {
+				return nil, grb.newError(nestingError, err.Error())
+			}
+
+			if err != nil {
+				return nil, grb.newError(parserError, err.Error())
+			}
+
+			return value, nil
+		}, ArgsAny())
+
+		module.DefineClassMethod("generate", func(grb *GRuby, self Value) (Value, Value) {
+			value, options, exc := jsonArgs(grb)
+			if exc != nil {
+				return nil, exc
+			}
+
+			encoded, err := generateJSON(value, jsonOption(grb, options, "pretty"))
+			if err != nil {
+				return nil, grb.newError(generatorError, err.Error())
+			}
+
+			return grb.newString(encoded), nil
+		}, ArgsAny())
+
+		return nil
+	}
+}
+
+// jsonArgs returns the value and the options passed to JSON.parse or
+// JSON.generate.
+func jsonArgs(grb *GRuby) (Value, *Hash, Value) {
+	args := grb.GetArgs()
+
+	var options *Hash
+	if len(args) == 2 && args[1].Type() == TypeHash {
+		options = &Hash{args[1]}
+		args = args[:1]
+	}
+
+	if len(args) != 1 {
+		message := "wrong number of arguments (given " + strconv.Itoa(len(args)) + ", expected 1)"
+
+		return nil, nil, grb.newError(grb.Class("ArgumentError", nil), message)
+	}
+
+	return args[0], options, nil
+}
+
+func jsonOption(grb *GRuby, options *Hash, name string) bool {
+	if options == nil {
+		return false
+	}
+
+	value := options.Get(grb.symbol(name))
+
+	return value != nil && value.Type() != TypeFalse
+}
+
+// jsonObject is a JSON object keeping the order of its keys.
+type jsonObject struct {
+	keys   []string
+	values []any
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	buf.WriteByte('{')
+
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		if err := encoder.Encode(key); err != nil {
+			return nil, err
+		}
+
+		buf.WriteByte(':')
+
+		if err := encoder.Encode(o.values[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// parseJSON decodes the JSON document to Go values and builds the Ruby value
+// from them.
+func parseJSON(grb *GRuby, source string, symbolizeNames bool) (Value, error) {
+	decoder := json.NewDecoder(strings.NewReader(source))
+	decoder.UseNumber()
+
+	value, err := decodeJSON(decoder, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errJSONTrailingData
+	}
+
+	builder := jsonBuilder{grb: grb, symbolizeNames: symbolizeNames}
+
+	return builder.value(value)
+}
+
+// decodeJSON reads a JSON value nested in depth arrays or objects from the
+// decoder, objects are decoded to jsonObject, numbers to json.Number.
+func decodeJSON(decoder *json.Decoder, depth int) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	if depth++; depth > jsonMaxNesting {
+		return nil, fmt.Errorf("%w: %d", errJSONTooDeep, depth)
+	}
+
+	var object jsonObject
+
+	array := []any{}
+
+	for decoder.More() {
+		if delim == '{' {
+			key, kErr := decoder.Token()
+			if kErr != nil {
+				return nil, kErr
+			}
+
+			// The decoder only returns strings as keys.
+			name, _ := key.(string)
+			object.keys = append(object.keys, name)
+		}
+
+		item, iErr := decodeJSON(decoder, depth)
+		if iErr != nil {
+			return nil, iErr
+		}
+
+		array = append(array, item)
+	}
+
+	// The closing delimiter.
+	if _, err = decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	if delim == '{' {
+		object.values = array
+
+		return object, nil
+	}
+
+	return array, nil
+}
+
+// jsonBuilder builds Ruby values from decoded JSON values.
+type jsonBuilder struct {
+	grb            *GRuby
+	symbolizeNames bool
+}
+
+func (b jsonBuilder) value(value any) (Value, error) {
+	switch value := value.(type) {
+	case nil:
+		return b.grb.NilValue(), nil
+	case bool:
+		return ToRuby(b.grb, value)
+	case string:
+		return ToRuby(b.grb, value)
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return ToRuby(b.grb, int(i))
+		}
+
+		f, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+
+		return ToRuby(b.grb, f)
+	case []any:
+		array := b.grb.value(C.mrb_ary_new(b.grb.state))
+
+		for _, item := range value {
+			if err := b.push(array, item); err != nil {
+				return nil, err
+			}
+		}
+
+		return array, nil
+	case jsonObject:
+		hash := Hash{b.grb.value(C.mrb_hash_new(b.grb.state))}
+
+		for i, key := range value.keys {
+			if err := b.set(hash, key, value.values[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		return hash.Value, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnknownType, value)
+	}
+}
+
+func (b jsonBuilder) push(array Value, item any) error {
+	defer b.grb.ArenaRestore(b.grb.ArenaSave())
+
+	value, err := b.value(item)
+	if err != nil {
+		return err
+	}
+
+	C.mrb_ary_push(b.grb.state, array.CValue(), value.CValue())
+
+	return nil
+}
+
+func (b jsonBuilder) set(hash Hash, key string, item any) error {
+	defer b.grb.ArenaRestore(b.grb.ArenaSave())
+
+	rbKey := b.grb.newString(key)
+	if b.symbolizeNames {
+		rbKey = b.grb.symbol(key)
+	}
+
+	value, err := b.value(item)
+	if err != nil {
+		return err
+	}
+
+	hash.Set(rbKey, value)
+
+	return nil
+}
+
+// generateJSON decodes the Ruby value to Go values and encodes them.
+func generateJSON(value Value, pretty bool) (string, error) {
+	goValue, err := jsonGoValue(value, 0)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+
+	if err = encoder.Encode(goValue); err != nil {
+		return "", err
+	}
+
+	// Encode terminates the value with a newline.
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// jsonGoValue decodes a Ruby value to the Go value encoded to JSON, hashes
+// are decoded to jsonObject to keep the order of their keys.
+func jsonGoValue(value Value, depth int) (any, error) {
+	if depth > jsonMaxNesting {
+		return nil, fmt.Errorf("%w: %d", errJSONTooDeep, depth)
+	}
+
+	switch value.Type() {
+	case TypeNil:
+		return nil, nil
+	case TypeTrue, TypeFalse, TypeFixnum, TypeString:
+		var result any
+		if err := Decode(&result, value); err != nil {
+			return nil, err
+		}
+
+		return result, nil
+	case TypeFloat:
+		var f float64
+		if err := Decode(&f, value); err != nil {
+			return nil, err
+		}
+
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%s %w", value.String(), errJSONNotAllowed)
+		}
+
+		return f, nil
+	case TypeArray:
+		items := MustToGo[Values](value)
+		array := make([]any, len(items))
+
+		for i, item := range items {
+			goItem, err := jsonGoValue(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			array[i] = goItem
+		}
+
+		return array, nil
+	case TypeHash:
+		return jsonGoObject(Hash{value}, depth)
+	default:
+		// Symbols and any other object.
+		return value.String(), nil
+	}
+}
+
+func jsonGoObject(hash Hash, depth int) (jsonObject, error) {
+	keys := hash.Keys()
+	object := jsonObject{keys: make([]string, len(keys)), values: make([]any, len(keys))}
+
+	for i, key := range keys {
+		value := hash.Get(key)
+		if value == nil {
+			value = key.GRuby().NilValue()
+		}
+
+		goValue, err := jsonGoValue(value, depth+1)
+		if err != nil {
+			return jsonObject{}, err
+		}
+
+		object.keys[i] = key.String()
+		object.values[i] = goValue
+	}
+
+	return object, nil
+}
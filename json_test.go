@@ -0,0 +1,81 @@
+package gruby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestWithJSON(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New(gruby.WithJSON()))
+	defer grb.Close()
+
+	value, err := grb.LoadString(`
+data = JSON.parse('{"name": "alice", "tags": ["a", "b"], "age": 30, "score": 1.5, "admin": false, "manager": null}')
+[data["name"], data["tags"], data["age"], data["score"], data["admin"], data["manager"], data.keys].inspect
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["alice", ["a", "b"], 30, 1.5, false, nil, ["name", "tags", "age", "score", "admin", "manager"]]`))
+
+	value, err = grb.LoadString(`JSON.parse('{"user": {"id": 7}}', symbolize_names: true)[:user][:id]`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gruby.MustToGo[int](value)).To(Equal(7))
+
+	value, err = grb.LoadString(`JSON.generate({name: "a\"<b>", list: [1, 2.5, nil, true], nested: {"k" => :v}})`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`{"name":"a\"<b>","list":[1,2.5,null,true],"nested":{"k":"v"}}`))
+
+	value, err = grb.LoadString(`JSON.generate({a: [1]}, pretty: true)`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("{\n  \"a\": [\n    1\n  ]\n}"))
+
+	value, err = grb.LoadString(`JSON.generate(["a\0b"])`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["a\u0000b"]`))
+
+	value, err = grb.LoadString(`JSON.parse(JSON.generate(["a\0b"]))[0].bytesize`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gruby.MustToGo[int](value)).To(Equal(3))
+
+	value, err = grb.LoadString(`
+begin
+  JSON.parse('{"a": ')
+rescue JSON::ParserError => e
+  e.class.to_s
+end
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("JSON::ParserError"))
+
+	for _, code := range []string{`JSON.parse("[1] [2]")`, `JSON.parse("nope")`, `JSON.parse("")`} {
+		_, err = grb.LoadString(code)
+		g.Expect(err).To(HaveOccurred(), code)
+	}
+
+	_, err = grb.LoadString(`JSON.generate(0.0 / 0)`)
+	g.Expect(err).To(MatchError("NaN not allowed in JSON"))
+
+	_, err = grb.LoadString(`a = []; a << a; JSON.generate(a)`)
+	g.Expect(err).To(MatchError(ContainSubstring("nesting is too deep")))
+
+	value, err = grb.LoadString(`JSON.parse("[" * 100 + "]" * 100).flatten`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("[]"))
+
+	value, err = grb.LoadString(`
+begin
+  JSON.parse("[" * 101 + "]" * 101)
+rescue JSON::ParserError => e
+  e.class.to_s
+end
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("JSON::NestingError"))
+
+	_, err = grb.LoadString(`JSON.parse('{"a":' * 1000 + "1" + "}" * 1000)`)
+	g.Expect(err).To(MatchError("nesting is too deep: 101"))
+}
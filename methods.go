@@ -3,32 +3,23 @@ package gruby
 // #include "gruby.h"
 import "C"
 
-type (
-	classMethodMap map[*C.struct_RClass]methodMap
-	methodMap      map[C.mrb_sym]Func
-)
-
-type methodsStore struct {
-	grb     *GRuby
-	classes classMethodMap
+// goMethod is a method defined in Go, the arguments it takes and the
+// capabilities needed to call it.
+type goMethod struct {
+	fn           Func
+	methodType   MethodType
+	spec         ArgSpec
+	capabilities Capabilities
 }
 
-func (s *methodsStore) add(class *C.struct_RClass, name string, callback Func) {
-	methodLookup := s.classes[class]
-	if methodLookup == nil {
-		methodLookup = make(methodMap)
-		s.classes[class] = methodLookup
-	}
+// defineGoMethod defines the method on the class, or on the singleton class
+// for class methods. The method holds the handle of the goMethod, which is
+// forgotten once the method is removed and garbage collected.
+func (g *GRuby) defineGoMethod(class *C.struct_RClass, name string, method goMethod) {
+	defer g.ArenaRestore(g.ArenaSave())
 
 	cstr := C.CString(name)
 	defer freeStr(cstr)
 
-	sym := C.mrb_intern_cstr(s.grb.state, cstr)
-	methodLookup[sym] = callback
-}
-
-func (s *methodsStore) get(class *C.struct_RClass, name C.mrb_sym) Func {
-	// the caller _must_ call `add`` before calling `get`, crashes otherwise.
-	cls := s.classes[class]
-	return cls[name]
+	C._go_mrb_define_go_method(g.state, class, cstr, g.newHandle(method).CValue(), C.mrb_aspec(method.spec))
 }
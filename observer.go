@@ -0,0 +1,70 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+import (
+	"time"
+)
+
+// CallEvent describes a call of a method defined in Go, or of a proc created
+// with NewProc or NewLambda, see WithCallObserver. Calls of procs are
+// reported on the Proc class.
+type CallEvent struct {
+	// Class is the name of the class or module the method is defined on.
+	Class string
+	// Method is the name the method was called with.
+	Method string
+	// ClassMethod is true for methods defined with DefineClassMethod.
+	ClassMethod bool
+	// Args is the number of arguments the method was called with.
+	Args int
+	// Duration is the time spent in the Go function.
+	Duration time.Duration
+	// Exception is true if the function returned an exception to raise.
+	Exception bool
+}
+
+// CallObserver is the signature of a function observing calls of methods
+// defined in Go.
+type CallObserver func(ev CallEvent)
+
+// WithCallObserver returns a Mutator making the VM report every call of a
+// method defined in Go to the observer, after the method returns. It may be
+// used multiple times to install several observers.
+func WithCallObserver(observer CallObserver) Mutator {
+	return func(grb *GRuby) error {
+		grb.callObservers = append(grb.callObservers, observer)
+		return nil
+	}
+}
+
+func (g *GRuby) observeCall(class *C.struct_RClass, methodType MethodType, method Func, self Value) (Value, Value) {
+	// The callinfo must be read before the call, it may be reallocated by it.
+	ev := CallEvent{
+		Class:       C.GoString(C.mrb_class_name(g.state, class)),
+		Method:      C.GoString(C._go_mrb_sym_name(g.state, g.state.c.ci.mid)),
+		ClassMethod: methodType == MethodTypeClass,
+		Args:        int(C.mrb_get_argc(g.state)),
+		Duration:    0,
+		Exception:   false,
+	}
+
+	// Class methods are stored on the singleton class, report the class
+	// itself.
+	if ev.ClassMethod {
+		ev.Class = C.GoString(C.mrb_class_name(g.state, C._go_mrb_class_ptr(self.CValue())))
+	}
+
+	start := time.Now()
+	result, exc := method(g, self)
+
+	ev.Duration = time.Since(start)
+	ev.Exception = exc != nil
+
+	for _, observer := range g.callObservers {
+		observer(ev)
+	}
+
+	return result, exc
+}
@@ -0,0 +1,75 @@
+package gruby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestWithCallObserver(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	var events []gruby.CallEvent
+
+	grb := gruby.Must(gruby.New(gruby.WithCallObserver(func(ev gruby.CallEvent) {
+		events = append(events, ev)
+	})))
+	defer grb.Close()
+
+	class := grb.DefineClass("Observed", nil)
+	class.DefineMethod("add", func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+		args := grb.GetArgs()
+		return gruby.MustToRuby(grb, gruby.MustToGo[int](args[0])+gruby.MustToGo[int](args[1])), nil
+	}, gruby.ArgsReq(2))
+	class.DefineClassMethod("fail", testCallbackException, gruby.ArgsNone())
+
+	_, err := grb.LoadString(`Observed.new.add(1, 2)`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = grb.LoadString(`Observed.fail`)
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(events).To(HaveLen(2))
+	g.Expect(events[0]).To(And(
+		HaveField("Class", "Observed"),
+		HaveField("Method", "add"),
+		HaveField("ClassMethod", false),
+		HaveField("Args", 2),
+		HaveField("Exception", false),
+	))
+	g.Expect(events[0].Duration).To(BeNumerically(">", 0))
+	g.Expect(events[1]).To(And(
+		HaveField("Class", "Observed"),
+		HaveField("Method", "fail"),
+		HaveField("ClassMethod", true),
+		HaveField("Args", 0),
+		HaveField("Exception", true),
+	))
+}
+
+func TestWithCallObserverProc(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	var events []gruby.CallEvent
+
+	grb := gruby.Must(gruby.New(gruby.WithCallObserver(func(ev gruby.CallEvent) {
+		events = append(events, ev)
+	})))
+	defer grb.Close()
+
+	grb.SetGlobalVariable("$proc", grb.NewProc(testCallback))
+
+	_, err := grb.LoadString(`$proc.call(1)`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(events).To(HaveLen(1))
+	g.Expect(events[0]).To(And(
+		HaveField("Class", "Proc"),
+		HaveField("Method", "call"),
+		HaveField("Args", 1),
+		HaveField("Exception", false),
+	))
+}
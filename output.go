@@ -0,0 +1,236 @@
+package gruby
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// stderrFileno is the file descriptor of $stderr, $stdout's is 1.
+const stderrFileno = 2
+
+// outputCode defines GRuby::Output, the class of $stdout and $stderr, on top
+// of its write method defined in Go, makes STDOUT and STDERR the same objects
+// and makes Kernel print through them.
+const outputCode = `
+class GRuby::Output
+  attr_reader :fileno
+
+  def initialize(fileno)
+    @fileno = fileno
+  end
+
+  def print(*args)
+    args.each { |arg| write(arg) }
+    nil
+  end
+
+  def puts(*args)
+    if args.empty?
+      write("\n")
+      return nil
+    end
+
+    args.flatten.each do |arg|
+      line = arg.to_s
+      write(line.end_with?("\n") ? line : line + "\n")
+    end
+    nil
+  end
+
+  def printf(*args)
+    write(format(*args))
+    nil
+  end
+
+  def <<(obj)
+    write(obj)
+    self
+  end
+
+  def flush
+    self
+  end
+
+  def sync
+    true
+  end
+
+  def sync=(value)
+    value
+  end
+
+  def tty?
+    false
+  end
+  alias isatty tty?
+end
+
+$stdout = GRuby::Output.new(1)
+$stderr = GRuby::Output.new(2)
+
+[[:STDOUT, $stdout], [:STDERR, $stderr]].each do |name, output|
+  Object.__send__(:remove_const, name) if Object.const_defined?(name)
+  Object.const_set(name, output)
+end
+
+module Kernel
+  def print(*args)
+    $stdout.print(*args)
+  end
+
+  def puts(*args)
+    $stdout.puts(*args)
+  end
+
+  def p(*args)
+    args.each { |arg| $stdout.write(arg.inspect, "\n") }
+    args.size <= 1 ? args.first : args
+  end
+
+  def warn(*messages)
+    $stderr.puts(*messages) unless messages.empty?
+    nil
+  end
+
+  # Kernel.puts and the others are module functions, with a copy on Kernel
+  # itself.
+  class << self
+    def print(*args)
+      $stdout.print(*args)
+    end
+
+    def puts(*args)
+      $stdout.puts(*args)
+    end
+
+    def p(*args)
+      args.each { |arg| $stdout.write(arg.inspect, "\n") }
+      args.size <= 1 ? args.first : args
+    end
+
+    def warn(*messages)
+      $stderr.puts(*messages) unless messages.empty?
+      nil
+    end
+  end
+end
+`
+
+// WithStdout returns a Mutator writing the standard output of scripts, from
+// puts, print, p, $stdout and STDOUT, to w instead of the process's stdout.
+//
+// Like WithStderr, it replaces $stdout, $stderr, STDOUT, STDERR and the
+// Kernel methods printing to them, so it must be applied before WithSandbox.
+func WithStdout(w io.Writer) Mutator {
+	return func(grb *GRuby) error {
+		if err := grb.installOutput(); err != nil {
+			return err
+		}
+
+		grb.stdout = w
+
+		return nil
+	}
+}
+
+// WithStderr returns a Mutator writing the standard error of scripts, from
+// warn, $stderr and STDERR, to w instead of the process's stderr. See WithStdout.
+func WithStderr(w io.Writer) Mutator {
+	return func(grb *GRuby) error {
+		if err := grb.installOutput(); err != nil {
+			return err
+		}
+
+		grb.stderr = w
+
+		return nil
+	}
+}
+
+// RedirectOutput writes the output of scripts to stdout and stderr until the
+// returned function is called, which restores the previous writers. A nil
+// writer leaves the stream as it is. It is meant to capture the output of a
+// single call:
+//
+//	var out bytes.Buffer
+//	restore, err := grb.RedirectOutput(&out, nil)
+//	...
+//	_, err = grb.LoadString(code)
+//	restore()
+//
+// The first call installs the Go-backed output like WithStdout, it fails if
+// the Kernel module has been frozen by WithSandbox.
+func (g *GRuby) RedirectOutput(stdout io.Writer, stderr io.Writer) (func(), error) {
+	if err := g.installOutput(); err != nil {
+		return nil, err
+	}
+
+	prevStdout, prevStderr := g.stdout, g.stderr
+
+	if stdout != nil {
+		g.stdout = stdout
+	}
+
+	if stderr != nil {
+		g.stderr = stderr
+	}
+
+	return func() {
+		g.stdout, g.stderr = prevStdout, prevStderr
+	}, nil
+}
+
+func (g *GRuby) installOutput() error {
+	if g.outputInstalled {
+		return nil
+	}
+
+	class := g.DefineClassUnder("Output", nil, g.DefineModule("GRuby"))
+	class.DefineMethod("write", outputWrite, ArgsAny())
+
+	if _, err := g.LoadString(outputCode); err != nil {
+		return fmt.Errorf("failed to install output: %w", err)
+	}
+
+	g.outputInstalled = true
+
+	return nil
+}
+
+// outputWriter returns the writer of the stream with the given file
+// descriptor, the process's ones by default.
+func (g *GRuby) outputWriter(fileno int) io.Writer {
+	if fileno == stderrFileno {
+		if g.stderr != nil {
+			return g.stderr
+		}
+
+		return os.Stderr
+	}
+
+	if g.stdout != nil {
+		return g.stdout
+	}
+
+	return os.Stdout
+}
+
+// outputWrite implements GRuby::Output#write(*objects), it returns the
+// number of bytes written.
+func outputWrite(grb *GRuby, self Value) (Value, Value) {
+	writer := grb.outputWriter(MustToGo[int](self.GetInstanceVariable("@fileno")))
+
+	written := 0
+
+	for _, arg := range grb.GetArgs() {
+		n, err := io.WriteString(writer, arg.String())
+		written += n
+
+		if err != nil {
+			return nil, grb.newError(grb.errorClass("IOError", "StandardError"), err.Error())
+		}
+	}
+
+	return MustToRuby(grb, written), nil
+}
@@ -0,0 +1,62 @@
+package gruby_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestWithStdout(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	var stdout, stderr bytes.Buffer
+
+	grb := gruby.Must(gruby.New(gruby.WithStdout(&stdout), gruby.WithStderr(&stderr)))
+	defer grb.Close()
+
+	value, err := grb.LoadString(`
+puts "hello", ["a", ["b"]], 1
+print "x", "y"
+$stdout << "z" << "\n"
+$stdout.printf("%03d\n", 7)
+warn "careful"
+$stderr.write("raw")
+STDOUT.puts "constant"
+Kernel.puts "module"
+Kernel.print "function\n"
+STDERR.write("!")
+p 1, "two"
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`[1, "two"]`))
+
+	g.Expect(stdout.String()).To(Equal("hello\na\nb\n1\nxyz\n007\nconstant\nmodule\nfunction\n1\n\"two\"\n"))
+	g.Expect(stderr.String()).To(Equal("careful\nraw!"))
+}
+
+func TestGRuby_RedirectOutput(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	var stdout, captured bytes.Buffer
+
+	grb := gruby.Must(gruby.New(gruby.WithStdout(&stdout)))
+	defer grb.Close()
+
+	restore, err := grb.RedirectOutput(&captured, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = grb.LoadString(`puts "captured"`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	restore()
+
+	_, err = grb.LoadString(`puts "logged"`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(captured.String()).To(Equal("captured\n"))
+	g.Expect(stdout.String()).To(Equal("logged\n"))
+}
@@ -0,0 +1,80 @@
+package gruby
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrUnknownPlugin = errors.New("unknown plugin")
+
+var plugins = pluginRegistry{ //nolint:gochecknoglobals
+	lock:     sync.RWMutex{},
+	mutators: map[string]Mutator{},
+}
+
+type pluginRegistry struct {
+	lock     sync.RWMutex
+	mutators map[string]Mutator
+}
+
+// RegisterPlugin makes a Mutator available by name, so tools built on gruby,
+// like the gruby command, can enable it without knowing about the package
+// that provides it. It is meant to be called from the init function of such
+// a package:
+//
+//	func init() {
+//	    gruby.RegisterPlugin("http", DefineHTTP)
+//	}
+//
+// If RegisterPlugin is called twice with the same name or if the mutator is
+// nil, it panics.
+func RegisterPlugin(name string, m Mutator) {
+	plugins.lock.Lock()
+	defer plugins.lock.Unlock()
+
+	if m == nil {
+		panic("gruby: RegisterPlugin mutator is nil")
+	}
+
+	if _, ok := plugins.mutators[name]; ok {
+		panic("gruby: RegisterPlugin called twice for plugin " + name)
+	}
+
+	plugins.mutators[name] = m
+}
+
+// Plugins returns a sorted list of the names of the registered plugins.
+func Plugins() []string {
+	plugins.lock.RLock()
+	defer plugins.lock.RUnlock()
+
+	names := make([]string, 0, len(plugins.mutators))
+	for name := range plugins.mutators {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// PluginMutators returns the mutators of the plugins with the given names,
+// ready to be passed to New.
+func PluginMutators(names ...string) ([]Mutator, error) {
+	plugins.lock.RLock()
+	defer plugins.lock.RUnlock()
+
+	mutators := make([]Mutator, len(names))
+	for i, name := range names {
+		m, ok := plugins.mutators[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPlugin, name)
+		}
+
+		mutators[i] = m
+	}
+
+	return mutators, nil
+}
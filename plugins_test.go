@@ -0,0 +1,37 @@
+package gruby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestRegisterPlugin(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	gruby.RegisterPlugin("test_plugin", func(grb *gruby.GRuby) error {
+		grb.DefineClass("PluginClass", nil).DefineConst("ANSWER", gruby.MustToRuby(grb, 42))
+		return nil
+	})
+
+	g.Expect(gruby.Plugins()).To(ContainElement("test_plugin"))
+
+	g.Expect(func() {
+		gruby.RegisterPlugin("test_plugin", func(*gruby.GRuby) error { return nil })
+	}).To(Panic())
+
+	mutators, err := gruby.PluginMutators("test_plugin")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	grb := gruby.Must(gruby.New(mutators...))
+	defer grb.Close()
+
+	value, err := grb.LoadString("PluginClass::ANSWER")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gruby.ToGo[int](value)).To(Equal(42))
+
+	_, err = gruby.PluginMutators("test_plugin", "missing_plugin")
+	g.Expect(err).To(MatchError(gruby.ErrUnknownPlugin))
+}
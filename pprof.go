@@ -0,0 +1,216 @@
+package gruby
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Field numbers of the messages of pprof's profile.proto.
+const (
+	pprofProfileSampleType    = 1
+	pprofProfileSample        = 2
+	pprofProfileLocation      = 4
+	pprofProfileFunction      = 5
+	pprofProfileStringTable   = 6
+	pprofProfileTimeNanos     = 9
+	pprofProfileDurationNanos = 10
+	pprofProfilePeriodType    = 11
+	pprofProfilePeriod        = 12
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocationID = 1
+	pprofSampleValue      = 2
+
+	pprofLocationID   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunctionID = 1
+	pprofLineLine       = 2
+
+	pprofFunctionID       = 1
+	pprofFunctionName     = 2
+	pprofFunctionFilename = 4
+)
+
+// WritePprof writes the profile as a gzipped pprof protobuf, which can be
+// viewed with go tool pprof. Every sample has two values: the number of
+// samples and the CPU time they represent.
+func (p *Profile) WritePprof(w io.Writer) error {
+	builder := newPprofBuilder()
+
+	var profile protoBuffer
+
+	for _, vt := range [][2]string{{"samples", "count"}, {"cpu", "nanoseconds"}} {
+		profile.message(pprofProfileSampleType, builder.valueType(vt[0], vt[1]))
+	}
+
+	for _, sample := range p.Samples {
+		ids := make([]uint64, len(sample.Stack))
+		for i, frame := range sample.Stack {
+			ids[i] = builder.location(frame)
+		}
+
+		var msg protoBuffer
+		msg.packed(pprofSampleLocationID, ids)
+		msg.packed(pprofSampleValue, []uint64{uint64(sample.Count), uint64(int64(sample.Count) * p.Interval.Nanoseconds())})
+		profile.message(pprofProfileSample, msg)
+	}
+
+	for _, location := range builder.locations {
+		profile.message(pprofProfileLocation, location)
+	}
+
+	for _, function := range builder.functions {
+		profile.message(pprofProfileFunction, function)
+	}
+
+	profile.integer(pprofProfileTimeNanos, uint64(p.Start.UnixNano()))
+	profile.integer(pprofProfileDurationNanos, uint64(p.Duration.Nanoseconds()))
+	profile.message(pprofProfilePeriodType, builder.valueType("cpu", "nanoseconds"))
+	profile.integer(pprofProfilePeriod, uint64(p.Interval.Nanoseconds()))
+
+	// The string table is the last as building the other messages fills it.
+	for _, str := range builder.strings {
+		profile.bytes(pprofProfileStringTable, []byte(str))
+	}
+
+	gz := gzip.NewWriter(w)
+
+	if _, err := gz.Write(profile); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+
+	return nil
+}
+
+// pprofBuilder deduplicates the strings, functions and locations of a profile.
+type pprofBuilder struct {
+	strings     []string
+	stringIDs   map[string]uint64
+	functions   []protoBuffer
+	functionIDs map[[2]string]uint64
+	locations   []protoBuffer
+	locationIDs map[ProfileFrame]uint64
+}
+
+func newPprofBuilder() *pprofBuilder {
+	return &pprofBuilder{
+		strings:     []string{""},
+		stringIDs:   map[string]uint64{"": 0},
+		functions:   nil,
+		functionIDs: map[[2]string]uint64{},
+		locations:   nil,
+		locationIDs: map[ProfileFrame]uint64{},
+	}
+}
+
+func (b *pprofBuilder) str(s string) uint64 {
+	id, ok := b.stringIDs[s]
+	if !ok {
+		id = uint64(len(b.strings))
+		b.strings = append(b.strings, s)
+		b.stringIDs[s] = id
+	}
+
+	return id
+}
+
+func (b *pprofBuilder) valueType(typ string, unit string) protoBuffer {
+	var msg protoBuffer
+	msg.integer(pprofValueTypeType, b.str(typ))
+	msg.integer(pprofValueTypeUnit, b.str(unit))
+
+	return msg
+}
+
+func (b *pprofBuilder) function(name string, file string) uint64 {
+	key := [2]string{name, file}
+
+	id, ok := b.functionIDs[key]
+	if !ok {
+		id = uint64(len(b.functions) + 1)
+
+		var msg protoBuffer
+		msg.integer(pprofFunctionID, id)
+		msg.integer(pprofFunctionName, b.str(name))
+		msg.integer(pprofFunctionFilename, b.str(file))
+
+		b.functions = append(b.functions, msg)
+		b.functionIDs[key] = id
+	}
+
+	return id
+}
+
+func (b *pprofBuilder) location(frame ProfileFrame) uint64 {
+	id, ok := b.locationIDs[frame]
+	if !ok {
+		id = uint64(len(b.locations) + 1)
+
+		var line protoBuffer
+		line.integer(pprofLineFunctionID, b.function(frame.Function, frame.File))
+		line.integer(pprofLineLine, uint64(frame.Line))
+
+		var msg protoBuffer
+		msg.integer(pprofLocationID, id)
+		msg.message(pprofLocationLine, line)
+
+		b.locations = append(b.locations, msg)
+		b.locationIDs[frame] = id
+	}
+
+	return id
+}
+
+// protoBuffer encodes protobuf messages, only the wire types used by pprof
+// are supported.
+type protoBuffer []byte
+
+const (
+	protoWireVarint = 0
+	protoWireBytes  = 2
+)
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuffer) tag(field int, wire int) {
+	b.varint(uint64(field<<3 | wire))
+}
+
+func (b *protoBuffer) integer(field int, v uint64) {
+	b.tag(field, protoWireVarint)
+	b.varint(v)
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.tag(field, protoWireBytes)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *protoBuffer) message(field int, msg protoBuffer) {
+	b.bytes(field, msg)
+}
+
+func (b *protoBuffer) packed(field int, values []uint64) {
+	var data protoBuffer
+	for _, v := range values {
+		data.varint(v)
+	}
+
+	b.bytes(field, data)
+}
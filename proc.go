@@ -0,0 +1,408 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+)
+
+var (
+	ErrNotProc     = errors.New("value is not a Proc")
+	ErrNotFunc     = errors.New("type is not a func")
+	ErrFuncResults = errors.New("func must return at most a value and an error")
+	ErrWrongArity  = errors.New("wrong number of arguments")
+)
+
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	valueType = reflect.TypeOf((*Value)(nil)).Elem()
+)
+
+// ProcToFunc returns a Go function of type F calling the given Proc, so
+// blocks and lambdas given by scripts can be stored and called like Go
+// callbacks:
+//
+//	onEvent, err := gruby.ProcToFunc[func(string, int) (bool, error)](grb.GetArgs()[0])
+//	...
+//	ok, err := onEvent("click", 2)
+//
+// Arguments are converted to Ruby like Go values returned to Ruby, the
+// result of the proc is converted with Decode. F can return nothing, a
+// value, an error or a value and an error. The error is an *ExceptionError
+// if the proc raises, or the error of Decode. If F doesn't return an error,
+// the function panics instead.
+//
+// The arity of lambdas must match the parameters of F, variadic functions
+// match lambdas with optional or rest parameters. Procs accept any number of
+// arguments like in Ruby.
+//
+// The proc is protected from the garbage collector as long as the function
+// is referenced, it is released by the next call to ProcToFunc or FullGC
+// once the function is garbage collected. The function must be called
+// while the VM is usable, from the goroutine using it.
+func ProcToFunc[F any](v Value) (F, error) {
+	var fn F
+
+	funcType := reflect.TypeOf(fn)
+	if funcType == nil || funcType.Kind() != reflect.Func {
+		return fn, fmt.Errorf("%w: %T", ErrNotFunc, fn)
+	}
+
+	if err := checkFuncResults(funcType); err != nil {
+		return fn, err
+	}
+
+	if v.Type() != TypeProc {
+		return fn, fmt.Errorf("%w: %s", ErrNotProc, v.Class())
+	}
+
+	if err := checkProcArity(v, funcType); err != nil {
+		return fn, err
+	}
+
+	grb := v.GRuby()
+	grb.unregisterReleasedProcs()
+	C.mrb_gc_register(grb.state, v.CValue())
+
+	ref := &procRef{proc: v}
+	runtime.SetFinalizer(ref, func(r *procRef) {
+		grb.releaseProc(r.proc)
+	})
+
+	call := func(in []reflect.Value) []reflect.Value {
+		result, err := callProc(ref.proc, funcType, in)
+
+		return procResults(funcType, result, err)
+	}
+
+	fn, _ = reflect.MakeFunc(funcType, call).Interface().(F)
+
+	return fn, nil
+}
+
+// procRef references the proc of a function returned by ProcToFunc, it is
+// garbage collected with the function.
+type procRef struct {
+	proc Value
+}
+
+// releaseProc queues the proc of a garbage collected function, it can be
+// called from any goroutine.
+func (g *GRuby) releaseProc(proc Value) {
+	g.releasedProcsMu.Lock()
+	defer g.releasedProcsMu.Unlock()
+
+	g.releasedProcs = append(g.releasedProcs, proc)
+}
+
+// unregisterReleasedProcs lets the garbage collector collect the procs of
+// the garbage collected functions returned by ProcToFunc.
+func (g *GRuby) unregisterReleasedProcs() {
+	g.releasedProcsMu.Lock()
+	released := g.releasedProcs
+	g.releasedProcs = nil
+	g.releasedProcsMu.Unlock()
+
+	for _, proc := range released {
+		C.mrb_gc_unregister(g.state, proc.CValue())
+	}
+}
+
+func checkFuncResults(funcType reflect.Type) error {
+	switch funcType.NumOut() {
+	case 0:
+		return nil
+	case 1:
+		return nil
+	case 2:
+		if funcType.Out(1) == errorType {
+			return nil
+		}
+	default:
+	}
+
+	return fmt.Errorf("%w: %s", ErrFuncResults, funcType)
+}
+
+func checkProcArity(v Value, funcType reflect.Type) error {
+	lambda, err := v.Call("lambda?")
+	if err != nil {
+		return err
+	}
+
+	if lambda.Type() != TypeTrue {
+		return nil
+	}
+
+	signature, err := procSignatureOf(v)
+	if err != nil {
+		return err
+	}
+
+	params := funcType.NumIn()
+
+	switch {
+	case signature.keywords:
+		// Go functions can't give keyword arguments.
+	case funcType.IsVariadic():
+		// The proc must take the fixed parameters, and any number of
+		// arguments after them.
+		if signature.required <= params-1 && signature.rest {
+			return nil
+		}
+	case params >= signature.required && (signature.rest || params <= signature.required+signature.optional):
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s for a lambda taking %s", ErrWrongArity, funcType, signature.parameters)
+}
+
+// procSignature describes the parameters of a proc, as told by
+// Proc#parameters.
+type procSignature struct {
+	parameters Value
+	required   int
+	optional   int
+	rest       bool
+	keywords   bool
+}
+
+func procSignatureOf(v Value) (procSignature, error) {
+	var signature procSignature
+
+	parameters, err := v.Call("parameters")
+	if err != nil {
+		return signature, err
+	}
+
+	signature.parameters = parameters
+	params := MustToGo[Values](parameters)
+
+	if len(params) == 0 {
+		// Procs defined in C, like the lambdas of NewLambda, don't
+		// describe their parameters, their arity is -1 if they take any.
+		arity, aErr := v.Call("arity")
+		if aErr != nil {
+			return signature, aErr
+		}
+
+		signature.rest = MustToGo[int](arity) < 0
+
+		return signature, nil
+	}
+
+	for _, param := range params {
+		switch MustToGo[Values](param)[0].String() {
+		case "req":
+			signature.required++
+		case "opt":
+			signature.optional++
+		case "rest":
+			signature.rest = true
+		case "keyreq":
+			signature.keywords = true
+		default:
+		}
+	}
+
+	return signature, nil
+}
+
+func callProc(v Value, funcType reflect.Type, in []reflect.Value) (Value, error) {
+	grb := v.GRuby()
+
+	// Variadic arguments come as a slice.
+	if funcType.IsVariadic() {
+		variadic := in[len(in)-1]
+		in = in[:len(in)-1]
+
+		for i := range variadic.Len() {
+			in = append(in, variadic.Index(i))
+		}
+	}
+
+	args := make(Values, 0, len(in))
+
+	for _, arg := range in {
+		value, err := ToRuby(grb, arg.Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, value)
+	}
+
+	return v.Call("call", args...)
+}
+
+func procResults(funcType reflect.Type, result Value, err error) []reflect.Value {
+	returnsError := funcType.NumOut() > 0 && funcType.Out(funcType.NumOut()-1) == errorType
+
+	var out reflect.Value
+	if err == nil && funcType.NumOut() > 0 && !returnsError || funcType.NumOut() == 2 {
+		out = reflect.Zero(funcType.Out(0))
+
+		if err == nil {
+			var decoded reflect.Value
+			if decoded, err = decodeType(funcType.Out(0), result); err == nil {
+				out = decoded
+			}
+		}
+	}
+
+	if err != nil && !returnsError {
+		panic(err)
+	}
+
+	switch {
+	case funcType.NumOut() == 0:
+		return nil
+	case funcType.NumOut() == 2:
+		return []reflect.Value{out, errorValue(err)}
+	case returnsError:
+		return []reflect.Value{errorValue(err)}
+	default:
+		return []reflect.Value{out}
+	}
+}
+
+func errorValue(err error) reflect.Value {
+	if err == nil {
+		return reflect.Zero(errorType)
+	}
+
+	return reflect.ValueOf(&err).Elem()
+}
+
+//export goGRBProcCall
+func goGRBProcCall(state *C.mrb_state, value C.mrb_value) C.mrb_value {
+	grb := states.get(state)
+	method, _ := grb.handle(grb.value(C._go_mrb_proc_handle(state))).(goMethod)
+
+	return callGoMethod(grb, state.proc_class, method, value)
+}
+
+// NewProc returns a Proc calling fn, so Go code can give blocks to Ruby
+// methods, with CallBlock for instance, without defining a method. fn gets
+// the arguments of the call with GetArgs. fn is forgotten when the proc is
+// garbage collected.
+//
+// Like for methods defined in Go, calling the proc requires the given
+// capabilities, see LoadStringWith, and calls are reported to the call
+// observers on the Proc class.
+func (g *GRuby) NewProc(fn Func, capabilities ...string) Value {
+	return g.newProc(fn, false, capabilities)
+}
+
+// NewLambda returns a lambda calling fn, which can be any Go function.
+// Arguments are converted with Decode, the lambda raises an ArgumentError
+// if it is called with a wrong number of arguments or a TypeError if they
+// can't be converted. fn can return nothing, a value, an error or a value
+// and an error, values are converted to Ruby like Go values returned to
+// Ruby and errors are raised as RuntimeError:
+//
+//	add, err := grb.NewLambda(func(a, b int) int { return a + b })
+//
+// Like for NewProc, fn is forgotten when the lambda is garbage collected and
+// calling the lambda requires the given capabilities.
+func (g *GRuby) NewLambda(fn any, capabilities ...string) (Value, error) {
+	fnValue := reflect.ValueOf(fn)
+	if fnValue.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%w: %T", ErrNotFunc, fn)
+	}
+
+	funcType := fnValue.Type()
+	if err := checkFuncResults(funcType); err != nil {
+		return nil, err
+	}
+
+	return g.newProc(func(grb *GRuby, _ Value) (Value, Value) {
+		in, exc := lambdaArgs(grb, funcType, grb.GetArgs())
+		if exc != nil {
+			return nil, exc
+		}
+
+		out := fnValue.Call(in)
+
+		if n := len(out); n > 0 && funcType.Out(n-1) == errorType {
+			if err, _ := out[n-1].Interface().(error); err != nil {
+				return nil, grb.newError(grb.Class("RuntimeError", nil), err.Error())
+			}
+
+			out = out[:n-1]
+		}
+
+		if len(out) == 0 {
+			return grb.NilValue(), nil
+		}
+
+		result, err := ToRuby(grb, out[0].Interface())
+		if err != nil {
+			return nil, grb.newError(grb.Class("TypeError", nil), err.Error())
+		}
+
+		return result, nil
+	}, true, capabilities), nil
+}
+
+func (g *GRuby) newProc(fn Func, lambda bool, capabilities Capabilities) Value {
+	var strict C.int
+	if lambda {
+		strict = 1
+	}
+
+	method := goMethod{fn: fn, methodType: MethodTypeInstance, spec: ArgsAny(), capabilities: capabilities}
+
+	return g.value(C._go_mrb_proc_new(g.state, g.newHandle(method).CValue(), strict))
+}
+
+func lambdaArgs(grb *GRuby, funcType reflect.Type, args Values) ([]reflect.Value, Value) {
+	params := funcType.NumIn()
+
+	if funcType.IsVariadic() && len(args) < params-1 || !funcType.IsVariadic() && len(args) != params {
+		expected := strconv.Itoa(params)
+		if funcType.IsVariadic() {
+			expected = strconv.Itoa(params-1) + "+"
+		}
+
+		return nil, grb.newError(grb.Class("ArgumentError", nil),
+			fmt.Sprintf("wrong number of arguments (given %d, expected %s)", len(args), expected))
+	}
+
+	in := make([]reflect.Value, len(args))
+
+	for i, arg := range args {
+		paramType := funcType.In(min(i, params-1))
+		if funcType.IsVariadic() && i >= params-1 {
+			paramType = paramType.Elem()
+		}
+
+		param, err := decodeType(paramType, arg)
+		if err != nil {
+			return nil, grb.newError(grb.Class("TypeError", nil), err.Error())
+		}
+
+		in[i] = param
+	}
+
+	return in, nil
+}
+
+// decodeType converts v to a Go value of the given type with Decode, Values
+// are kept as they are.
+func decodeType(typ reflect.Type, v Value) (reflect.Value, error) {
+	out := reflect.New(typ)
+
+	if typ == valueType {
+		out.Elem().Set(reflect.ValueOf(v))
+	} else if err := Decode(out.Interface(), v); err != nil {
+		return reflect.Value{}, err
+	}
+
+	return out.Elem(), nil
+}
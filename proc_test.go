@@ -0,0 +1,247 @@
+package gruby_test
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestProcToFunc(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	var handlers []func(string, int) (bool, error)
+
+	grb.TopSelf().SingletonClass().DefineMethod("on_event", func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+		handler, err := gruby.ProcToFunc[func(string, int) (bool, error)](grb.GetArgs()[0])
+		if err != nil {
+			return nil, gruby.Must(grb.Class("ArgumentError", nil).New(gruby.MustToRuby(grb, err.Error())))
+		}
+
+		handlers = append(handlers, handler)
+
+		return grb.NilValue(), nil
+	}, gruby.ArgsBlock())
+
+	_, err := grb.LoadString(`
+on_event { |name, count| name == "click" && count > 1 }
+on_event { |name| raise ArgumentError, "unknown event #{name}" }
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(handlers).To(HaveLen(2))
+
+	ok, err := handlers[0]("click", 2)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+
+	ok, err = handlers[0]("click", 1)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ok).To(BeFalse())
+
+	_, err = handlers[1]("hover", 1)
+	g.Expect(err).To(MatchError("unknown event hover"))
+
+	lambda, err := grb.LoadString(`->(a, b) { a + b }`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	add, err := gruby.ProcToFunc[func(int, int) int](lambda)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(add(40, 2)).To(Equal(42))
+
+	_, err = gruby.ProcToFunc[func(int) int](lambda)
+	g.Expect(err).To(MatchError(gruby.ErrWrongArity))
+
+	optional, err := grb.LoadString(`->(a, b = 1) { a * b }`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	multiply, err := gruby.ProcToFunc[func(int, int) int](optional)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(multiply(6, 7)).To(Equal(42))
+
+	_, err = gruby.ProcToFunc[func(int) int](optional)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = gruby.ProcToFunc[func(int, int, int) int](optional)
+	g.Expect(err).To(MatchError(gruby.ErrWrongArity))
+
+	keywords, err := grb.LoadString(`->(a, b:) { a + b }`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = gruby.ProcToFunc[func(int) int](keywords)
+	g.Expect(err).To(MatchError(gruby.ErrWrongArity))
+
+	sum, err := grb.LoadString(`->(*numbers) { numbers.inject(0) { |sum, n| sum + n } }`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	sumFunc, err := gruby.ProcToFunc[func(...int) (gruby.Value, error)](sum)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	value, err := sumFunc(1, 2, 3)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gruby.MustToGo[int](value)).To(Equal(6))
+
+	_, err = gruby.ProcToFunc[func() (int, int)](lambda)
+	g.Expect(err).To(MatchError(gruby.ErrFuncResults))
+
+	_, err = gruby.ProcToFunc[func()](gruby.MustToRuby(grb, 1))
+	g.Expect(err).To(MatchError(gruby.ErrNotProc))
+}
+
+func TestNewProc(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	array, err := grb.LoadString(`[1, 2, 3]`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	double := grb.NewProc(func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+		return gruby.MustToRuby(grb, gruby.MustToGo[int](grb.GetArgs()[0])*2), nil
+	})
+
+	result, err := array.CallBlock("map", double)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.String()).To(Equal("[2, 4, 6]"))
+
+	grb.SetGlobalVariable("$double", double)
+
+	result, err = grb.LoadString(`[$double.call(21), $double.lambda?]`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.String()).To(Equal("[42, false]"))
+}
+
+func TestNewLambda(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	greet, err := grb.NewLambda(func(name string, times int) (string, error) {
+		if times < 0 {
+			return "", errors.New("times must be positive")
+		}
+
+		return strings.Repeat("hello "+name+"! ", times), nil
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	grb.SetGlobalVariable("$greet", greet)
+
+	result, err := grb.LoadString(`$greet.call("bob", 2)`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.String()).To(Equal("hello bob! hello bob! "))
+
+	result, err = grb.LoadString(`$greet.lambda?`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.String()).To(Equal("true"))
+
+	_, err = grb.LoadString(`$greet.call("bob")`)
+	g.Expect(err).To(MatchError("wrong number of arguments (given 1, expected 2)"))
+
+	_, err = grb.LoadString(`$greet.call("bob", -1)`)
+	g.Expect(err).To(MatchError("times must be positive"))
+
+	sum, err := grb.NewLambda(func(numbers ...int) int {
+		total := 0
+		for _, n := range numbers {
+			total += n
+		}
+
+		return total
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	result, err = sum.Call("call", gruby.MustToRuby(grb, 1), gruby.MustToRuby(grb, 2), gruby.MustToRuby(grb, 3))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gruby.MustToGo[int](result)).To(Equal(6))
+
+	_, err = grb.NewLambda(42)
+	g.Expect(err).To(MatchError(gruby.ErrNotFunc))
+}
+
+func TestProcToFuncRelease(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	_, err := grb.LoadString(`
+def capture(value)
+  -> { value }
+end
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	var collected atomic.Bool
+
+	func() {
+		defer grb.ArenaRestore(grb.ArenaSave())
+
+		// The lambda holds a future whose result is collected with it.
+		future := gruby.Must(grb.Async(func() (any, error) {
+			result := &[64]byte{}
+			runtime.SetFinalizer(result, func(*[64]byte) { collected.Store(true) })
+
+			return result, nil
+		}))
+
+		lambda, cErr := grb.TopSelf().Call("capture", future)
+		g.Expect(cErr).ToNot(HaveOccurred())
+
+		fn, fErr := gruby.ProcToFunc[func() gruby.Value](lambda)
+		g.Expect(fErr).ToNot(HaveOccurred())
+		g.Expect(fn().Type()).To(Equal(gruby.TypeObject))
+	}()
+
+	g.Eventually(func() bool {
+		runtime.GC()
+		grb.FullGC()
+		runtime.GC()
+
+		return collected.Load()
+	}).Should(BeTrue())
+}
+
+func TestNewProcCollected(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	var collected atomic.Bool
+
+	func() {
+		defer grb.ArenaRestore(grb.ArenaSave())
+
+		data := &[64]byte{}
+		runtime.SetFinalizer(data, func(*[64]byte) { collected.Store(true) })
+
+		proc := grb.NewProc(func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+			return gruby.MustToRuby(grb, len(data)), nil
+		})
+
+		result, err := proc.Call("call")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(gruby.MustToGo[int](result)).To(Equal(64))
+	}()
+
+	// The Go function goes away with the proc.
+	g.Eventually(func() bool {
+		grb.FullGC()
+		runtime.GC()
+
+		return collected.Load()
+	}).Should(BeTrue())
+}
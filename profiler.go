@@ -0,0 +1,184 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+const (
+	// DefaultProfilerInterval is the sampling interval used when
+	// StartProfiler is called with 0.
+	DefaultProfilerInterval = 10 * time.Millisecond
+
+	maxProfileDepth = 128
+)
+
+// ProfileFrame is a frame of a sampled call stack.
+type ProfileFrame struct {
+	// Function is "Class#method", "block in Class#method" or "<main>" for
+	// the top-level and class bodies.
+	Function string
+	File     string
+	Line     int
+}
+
+// ProfileSample is a call stack, the innermost frame first, and the number of
+// times it was sampled.
+type ProfileSample struct {
+	Stack []ProfileFrame
+	Count int
+}
+
+// Profile is the result of sampling the call stack, see StartProfiler.
+type Profile struct {
+	Start    time.Time
+	Duration time.Duration
+	Interval time.Duration
+	Samples  []ProfileSample
+}
+
+type profiler struct {
+	start    time.Time
+	interval time.Duration
+	samples  map[string]*ProfileSample
+	remove   func()
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// StartProfiler starts sampling the Ruby call stack every interval. Time spent
+// in methods defined in Go is attributed to the Ruby code calling them.
+// Calling it while the profiler is running restarts it.
+//
+// Use Profile.WritePprof to view the result with go tool pprof.
+func (g *GRuby) StartProfiler(interval time.Duration) {
+	g.StopProfiler()
+
+	if interval <= 0 {
+		interval = DefaultProfilerInterval
+	}
+
+	prof := &profiler{
+		start:    time.Now(),
+		interval: interval,
+		samples:  map[string]*ProfileSample{},
+		remove:   nil,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// Samples are taken by the code fetch hook, the listener only keeps it
+	// enabled.
+	prof.remove = g.addTraceListener(func(*TraceEvent) {})
+	g.profiler = prof
+
+	go func(state *C.mrb_state) {
+		defer close(prof.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				profileTick(state)
+			case <-prof.stop:
+				return
+			}
+		}
+	}(g.state)
+}
+
+// profileTick asks the code fetch hook to take a sample at the next
+// instruction, it is ignored while the VM is idle.
+func profileTick(state *C.mrb_state) {
+	C._go_profile_tick(state)
+}
+
+// StopProfiler stops sampling and returns the profile recorded since
+// StartProfiler. It returns nil if the profiler was not started.
+func (g *GRuby) StopProfiler() *Profile {
+	if g.profiler == nil {
+		return nil
+	}
+
+	prof := g.profiler
+	g.profiler = nil
+
+	close(prof.stop)
+	<-prof.done
+	prof.remove()
+
+	samples := make([]ProfileSample, 0, len(prof.samples))
+	for _, sample := range prof.samples {
+		samples = append(samples, *sample)
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Count > samples[j].Count
+	})
+
+	return &Profile{
+		Start:    prof.start,
+		Duration: time.Since(prof.start),
+		Interval: prof.interval,
+		Samples:  samples,
+	}
+}
+
+//export goProfileSample
+func goProfileSample(state *C.mrb_state, irep *C.mrb_irep, pc C.int, count C.int) {
+	grb := states.get(state)
+	if grb == nil || grb.profiler == nil {
+		return
+	}
+
+	var frames [maxProfileDepth]C._go_profile_frame
+
+	n := int(C._go_profile_walk(state, irep, pc, (*C._go_profile_frame)(unsafe.Pointer(&frames[0])), maxProfileDepth))
+
+	stack := make([]ProfileFrame, n)
+	key := strings.Builder{}
+
+	for i, frame := range frames[:n] {
+		stack[i] = ProfileFrame{
+			Function: profileFunction(frame),
+			File:     C.GoString(frame.file),
+			Line:     int(frame.line),
+		}
+
+		key.WriteString(stack[i].Function)
+		key.WriteByte(0)
+		key.WriteString(stack[i].File)
+		key.WriteByte(0)
+		key.WriteString(strconv.Itoa(stack[i].Line))
+		key.WriteByte(0)
+	}
+
+	sample, ok := grb.profiler.samples[key.String()]
+	if !ok {
+		sample = &ProfileSample{Stack: stack, Count: 0}
+		grb.profiler.samples[key.String()] = sample
+	}
+
+	sample.Count += int(count)
+}
+
+func profileFunction(frame C._go_profile_frame) string {
+	if frame.method == nil {
+		return "<main>"
+	}
+
+	name := C.GoString(frame.class_name) + "#" + C.GoString(frame.method)
+	if frame.block != 0 {
+		return "block in " + name
+	}
+
+	return name
+}
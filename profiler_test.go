@@ -0,0 +1,90 @@
+package gruby_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestProfiler(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	g.Expect(grb.StopProfiler()).To(BeNil())
+
+	grb.StartProfiler(time.Millisecond)
+
+	_, _, err := grb.LoadFile("busy.rb", `def busy
+  deadline = Time.now + 0.1
+  i = 0
+  i += 1 while Time.now < deadline
+  i
+end
+
+busy
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	profile := grb.StopProfiler()
+	g.Expect(profile.Interval).To(Equal(time.Millisecond))
+	g.Expect(profile.Samples).ToNot(BeEmpty())
+	g.Expect(profile.Samples[0].Stack).To(ContainElement(gruby.ProfileFrame{Function: "Object#busy", File: "busy.rb", Line: 4}))
+	g.Expect(profile.Samples[0].Stack).To(ContainElement(gruby.ProfileFrame{Function: "<main>", File: "busy.rb", Line: 8}))
+
+	var out bytes.Buffer
+	g.Expect(profile.WritePprof(&out)).To(Succeed())
+
+	reader, err := gzip.NewReader(&out)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	content, err := io.ReadAll(reader)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(content)).To(ContainSubstring("Object#busy"))
+	g.Expect(string(content)).To(ContainSubstring("busy.rb"))
+}
+
+func TestProfilerIdle(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	grb.TopSelf().SingletonClass().DefineMethod("tick", func(grb *gruby.GRuby, self gruby.Value) (gruby.Value, gruby.Value) {
+		grb.ProfileTick()
+
+		return grb.NilValue(), nil
+	}, gruby.ArgsNone())
+
+	// The ticker doesn't fire during the test, ticks are driven by hand.
+	grb.StartProfiler(time.Hour)
+
+	_, err := grb.LoadString(`a = 1`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The VM is idle, the ticks must not be charged to the next load.
+	for range 10 {
+		grb.ProfileTick()
+	}
+
+	_, err = grb.LoadString(`b = 2`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(grb.StopProfiler().Samples).To(BeEmpty())
+
+	grb.StartProfiler(time.Hour)
+
+	_, err = grb.LoadString(`tick; c = 3`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	profile := grb.StopProfiler()
+	g.Expect(profile.Samples).To(HaveLen(1))
+	g.Expect(profile.Samples[0].Count).To(Equal(1))
+}
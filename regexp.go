@@ -0,0 +1,681 @@
+package gruby
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The Regexp option flags, like Ruby's Regexp::IGNORECASE and friends.
+const (
+	regexpIgnoreCase = 1
+	regexpExtended   = 2
+	regexpMultiline  = 4
+)
+
+// regexpCacheSize is the number of compiled expressions kept by a VM.
+const regexpCacheSize = 1024
+
+// regexpCode defines Regexp and MatchData on top of the methods defined in
+// Go, and makes the String methods taking patterns accept them.
+const regexpCode = `
+class Regexp
+  IGNORECASE = 1
+  EXTENDED = 2
+  MULTILINE = 4
+
+  attr_reader :source, :options
+
+  def self.compile(*args)
+    new(*args)
+  end
+
+  def self.union(*patterns)
+    sources = patterns.flatten.map do |pattern|
+      pattern.is_a?(Regexp) ? "(?:#{pattern.source})" : escape(pattern.to_s)
+    end
+    new(sources.join("|"))
+  end
+
+  def self.last_match(n = nil)
+    n.nil? || $~.nil? ? $~ : $~[n]
+  end
+
+  def initialize(source, options = nil, _encoding = nil)
+    if source.is_a?(Regexp)
+      options = source.options
+      source = source.source
+    end
+    raise TypeError, "no implicit conversion of #{source.class} into String" unless source.is_a?(String)
+
+    @source = source
+    @options =
+      case options
+      when Integer then options
+      when String
+        flags = 0
+        flags |= IGNORECASE if options.include?("i")
+        flags |= EXTENDED if options.include?("x")
+        flags |= MULTILINE if options.include?("m")
+        flags
+      when nil, false then 0
+      else IGNORECASE
+      end
+    __compile
+  end
+
+  def match(str, pos = 0)
+    md = nil
+    unless str.nil?
+      str = str.to_s
+      pos += str.bytesize if pos < 0
+      offsets = __match(str, pos) if pos >= 0 && pos <= str.bytesize
+      md = MatchData.new(self, str, offsets) if offsets
+    end
+    Regexp.__send__(:__last_match=, md)
+    md && block_given? ? yield(md) : md
+  end
+
+  def match?(str, pos = 0)
+    return false if str.nil?
+
+    str = str.to_s
+    pos += str.bytesize if pos < 0
+    pos >= 0 && pos <= str.bytesize && !__match(str, pos).nil?
+  end
+
+  def =~(str)
+    md = match(str)
+    md && md.begin(0)
+  end
+
+  def ===(other)
+    (other.is_a?(String) || other.is_a?(Symbol)) && match?(other)
+  end
+
+  def ==(other)
+    other.is_a?(Regexp) && source == other.source && options == other.options
+  end
+  alias eql? ==
+
+  def hash
+    [source, options].hash
+  end
+
+  def casefold?
+    options & IGNORECASE != 0
+  end
+
+  def names
+    __group_names.reject(&:empty?).uniq
+  end
+
+  def to_s
+    on = __flags
+    off = "mix".delete(on)
+    "(?#{on}#{off.empty? ? "" : "-" + off}:#{source})"
+  end
+
+  def inspect
+    "/#{source}/#{__flags}"
+  end
+
+  private
+
+  def __flags
+    flags = ""
+    flags << "m" if options & MULTILINE != 0
+    flags << "i" if options & IGNORECASE != 0
+    flags << "x" if options & EXTENDED != 0
+    flags
+  end
+
+  private :__compile, :__match, :__match_all, :__group_names
+
+  class << self
+    private :__last_match=, :__expand
+  end
+end
+
+class MatchData
+  attr_reader :regexp, :string
+
+  def initialize(regexp, string, offsets)
+    @regexp = regexp
+    @string = string
+    @offsets = offsets
+  end
+
+  def [](index, length = nil)
+    return to_a[index, length] if length
+    return to_a[index] if index.is_a?(Range)
+
+    b, e = offset(index)
+    b && @string.byteslice(b, e - b)
+  end
+
+  def offset(index)
+    i = __index(index)
+    return [nil, nil] if i < 0 || i >= size || @offsets[i * 2] < 0
+
+    [@offsets[i * 2], @offsets[i * 2 + 1]]
+  end
+
+  def begin(index)
+    offset(index)[0]
+  end
+
+  def end(index)
+    offset(index)[1]
+  end
+
+  def size
+    @offsets.size / 2
+  end
+  alias length size
+
+  def to_a
+    (0...size).map { |i| self[i] }
+  end
+
+  def captures
+    to_a[1..-1]
+  end
+
+  def names
+    regexp.names
+  end
+
+  def named_captures
+    captures = {}
+    names.each { |name| captures[name] = self[name] }
+    captures
+  end
+
+  def values_at(*indexes)
+    indexes.map { |index| self[index] }
+  end
+
+  def pre_match
+    @string.byteslice(0, self.begin(0))
+  end
+
+  def post_match
+    e = self.end(0)
+    @string.byteslice(e, @string.bytesize - e)
+  end
+
+  def to_s
+    self[0]
+  end
+
+  def inspect
+    "#<MatchData #{self[0].inspect}>"
+  end
+
+  private
+
+  def __index(index)
+    return index + size if index.is_a?(Integer) && index < 0
+    return index if index.is_a?(Integer)
+
+    i = regexp.__send__(:__group_names).rindex(index.to_s)
+    raise IndexError, "undefined group name reference: #{index}" unless i
+
+    i
+  end
+end
+
+class String
+  alias __gruby_sub sub
+  alias __gruby_gsub gsub
+  alias __gruby_split split
+
+  def =~(pattern)
+    raise TypeError, "wrong argument type String (expected Regexp)" if pattern.is_a?(String)
+
+    pattern =~ self
+  end
+
+  def match(pattern, pos = 0, &block)
+    pattern = Regexp.new(pattern) unless pattern.is_a?(Regexp)
+    pattern.match(self, pos, &block)
+  end
+
+  def match?(pattern, pos = 0)
+    pattern = Regexp.new(pattern) unless pattern.is_a?(Regexp)
+    pattern.match?(self, pos)
+  end
+
+  def scan(pattern, &block)
+    pattern = Regexp.new(Regexp.escape(pattern)) unless pattern.is_a?(Regexp)
+    result = []
+    pattern.__send__(:__match_all, self).each do |offsets|
+      md = MatchData.new(pattern, self, offsets)
+      Regexp.__send__(:__last_match=, md)
+      item = md.size > 1 ? md.captures : md[0]
+      block ? block.call(item) : result << item
+    end
+    block ? self : result
+  end
+
+  def sub(pattern, *args, &block)
+    return __gruby_sub(pattern, *args, &block) unless pattern.is_a?(Regexp)
+
+    md = pattern.match(self)
+    return dup unless md
+
+    md.pre_match + __gruby_replacement(md, args, block) + md.post_match
+  end
+
+  def gsub(pattern, *args, &block)
+    return __gruby_gsub(pattern, *args, &block) unless pattern.is_a?(Regexp)
+
+    result = ""
+    last = 0
+    pattern.__send__(:__match_all, self).each do |offsets|
+      md = MatchData.new(pattern, self, offsets)
+      Regexp.__send__(:__last_match=, md)
+      result << byteslice(last, md.begin(0) - last) << __gruby_replacement(md, args, block)
+      last = md.end(0)
+    end
+    result << byteslice(last, bytesize - last)
+  end
+
+  def split(pattern = nil, limit = 0)
+    return __gruby_split(pattern, limit) unless pattern.is_a?(Regexp)
+
+    result = []
+    last = 0
+    pattern.__send__(:__match_all, self).each do |offsets|
+      break if limit > 0 && result.size == limit - 1
+
+      b = offsets[0]
+      e = offsets[1]
+      next if b == e && (b == 0 || b == bytesize)
+
+      result << byteslice(last, b - last)
+      (1...offsets.size / 2).each do |i|
+        result << byteslice(offsets[i * 2], offsets[i * 2 + 1] - offsets[i * 2]) if offsets[i * 2] >= 0
+      end
+      last = e
+    end
+    result << byteslice(last, bytesize - last)
+    result.pop while limit == 0 && !result.empty? && result.last.empty?
+    result
+  end
+
+  private
+
+  def __gruby_replacement(md, args, block)
+    return block.call(md[0]).to_s if args.empty?
+    return args[0][md[0]].to_s if args[0].is_a?(Hash)
+
+    Regexp.__send__(:__expand, args[0].to_s, md)
+  end
+end
+`
+
+// WithRegexp returns a Mutator defining the Regexp and MatchData classes,
+// backed by Go's regexp package, and making String#match, =~, match?, scan,
+// sub, gsub and split accept regular expressions. Regexp literals work too.
+//
+// The expressions have RE2 semantics: they run in linear time, which makes
+// them safe with untrusted input, but don't support backreferences and
+// lookarounds, using them raises RegexpError. Like in Ruby, ^ and $ match at
+// line boundaries and the m option makes . match newlines. MatchData offsets
+// are in bytes.
+//
+// It must be applied before WithSandbox, which freezes String.
+func WithRegexp() Mutator {
+	return func(grb *GRuby) error {
+		cache := map[string]*regexp.Regexp{}
+
+		// The shifted expressions match after any character, they match from
+		// a position in a string with the character before it, which ^ and
+		// \b look at.
+		compile := func(grb *GRuby, self Value, shifted bool) (*regexp.Regexp, Value) {
+			source := self.GetInstanceVariable("@source").String()
+			options := MustToGo[int](self.GetInstanceVariable("@options"))
+			goSource := goRegexpSource(source, options)
+			key := strconv.Itoa(options) + "/" + source
+
+			if shifted {
+				goSource = "(?s:.)(?:" + goSource + ")"
+				key = "shifted/" + key
+			}
+
+			if re, ok := cache[key]; ok {
+				return re, nil
+			}
+
+			re, err := regexp.Compile(goSource)
+			if err != nil {
+				return nil, grb.newError(grb.errorClass("RegexpError", "StandardError"), err.Error())
+			}
+
+			if len(cache) >= regexpCacheSize {
+				clear(cache)
+			}
+
+			cache[key] = re
+
+			return re, nil
+		}
+
+		compiled := func(grb *GRuby, self Value) (*regexp.Regexp, Value) {
+			return compile(grb, self, false)
+		}
+
+		class := grb.DefineClass("Regexp", nil)
+		grb.errorClass("RegexpError", "StandardError")
+
+		class.DefineMethod("__compile", func(grb *GRuby, self Value) (Value, Value) {
+			if _, exc := compiled(grb, self); exc != nil {
+				return nil, exc
+			}
+
+			return self, nil
+		}, ArgsNone())
+
+		class.DefineMethod("__match", func(grb *GRuby, self Value) (Value, Value) {
+			str, pos, exc := regexpMatchArgs(grb)
+			if exc != nil {
+				return nil, exc
+			}
+
+			re, exc := compile(grb, self, pos > 0)
+			if exc != nil {
+				return nil, exc
+			}
+
+			if pos == 0 {
+				loc := re.FindStringSubmatchIndex(str)
+				if loc == nil {
+					return grb.NilValue(), nil
+				}
+
+				return regexpOffsets(grb, loc, 0), nil
+			}
+
+			// Match from the character before pos, the match starts after
+			// the character the shifted expression matched first.
+			_, size := utf8.DecodeLastRuneInString(str[:pos])
+			start := pos - size
+
+			loc := re.FindStringSubmatchIndex(str[start:])
+			if loc == nil {
+				return grb.NilValue(), nil
+			}
+
+			_, size = utf8.DecodeRuneInString(str[start+loc[0]:])
+			loc[0] += size
+
+			return regexpOffsets(grb, loc, start), nil
+		}, ArgsReq(2))
+
+		class.DefineMethod("__match_all", func(grb *GRuby, self Value) (Value, Value) {
+			re, exc := compiled(grb, self)
+			if exc != nil {
+				return nil, exc
+			}
+
+			matches := re.FindAllStringSubmatchIndex(grb.GetArgs()[0].String(), -1)
+
+			result := make(Values, len(matches))
+			for i, loc := range matches {
+				result[i] = regexpOffsets(grb, loc, 0)
+			}
+
+			return MustToRuby(grb, result), nil
+		}, ArgsReq(1))
+
+		class.DefineMethod("__group_names", func(grb *GRuby, self Value) (Value, Value) {
+			re, exc := compiled(grb, self)
+			if exc != nil {
+				return nil, exc
+			}
+
+			names := re.SubexpNames()
+
+			result := make(Values, len(names))
+			for i, name := range names {
+				result[i] = MustToRuby(grb, name)
+			}
+
+			return MustToRuby(grb, result), nil
+		}, ArgsNone())
+
+		class.DefineClassMethod("escape", func(grb *GRuby, self Value) (Value, Value) {
+			return MustToRuby(grb, regexp.QuoteMeta(grb.GetArgs()[0].String())), nil
+		}, ArgsReq(1))
+
+		class.DefineClassMethod("quote", func(grb *GRuby, self Value) (Value, Value) {
+			return MustToRuby(grb, regexp.QuoteMeta(grb.GetArgs()[0].String())), nil
+		}, ArgsReq(1))
+
+		class.DefineClassMethod("__last_match=", func(grb *GRuby, self Value) (Value, Value) {
+			match := grb.GetArgs()[0]
+			grb.setLastMatch(match)
+
+			return match, nil
+		}, ArgsReq(1))
+
+		class.DefineClassMethod("__expand", func(grb *GRuby, self Value) (Value, Value) {
+			args := grb.GetArgs()
+
+			result, err := regexpExpand(args[0].String(), args[1])
+			if err != nil {
+				return nil, grb.newError(grb.Class("IndexError", nil), err.Error())
+			}
+
+			return MustToRuby(grb, result), nil
+		}, ArgsReq(2))
+
+		if _, err := grb.LoadString(regexpCode); err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
+
+// regexpMatchArgs returns the string and the byte position Regexp#__match
+// gets, raising if the position isn't in the string.
+func regexpMatchArgs(grb *GRuby) (string, int, Value) {
+	args := grb.GetArgs()
+
+	if args[0].Type() != TypeString {
+		message := "wrong argument type " + args[0].Class().String() + " (expected String)"
+
+		return "", 0, grb.newError(grb.Class("TypeError", nil), message)
+	}
+
+	if args[1].Type() != TypeFixnum {
+		message := "no implicit conversion of " + args[1].Class().String() + " into Integer"
+
+		return "", 0, grb.newError(grb.Class("TypeError", nil), message)
+	}
+
+	str := args[0].String()
+	pos := MustToGo[int](args[1])
+
+	if pos < 0 || pos > len(str) {
+		message := "position " + strconv.Itoa(pos) + " out of string"
+
+		return "", 0, grb.newError(grb.Class("ArgumentError", nil), message)
+	}
+
+	return str, pos, nil
+}
+
+// setLastMatch sets $~ and the $1 to $9 variables.
+func (g *GRuby) setLastMatch(match Value) {
+	g.SetGlobalVariable("$~", match)
+
+	var groups Values
+	if match.Type() != TypeNil {
+		if values, err := match.Call("to_a"); err == nil {
+			groups = MustToGo[Values](values)
+		}
+	}
+
+	for i := 1; i <= 9; i++ {
+		group := g.NilValue()
+		if i < len(groups) {
+			group = groups[i]
+		}
+
+		g.SetGlobalVariable("$"+strconv.Itoa(i), group)
+	}
+}
+
+// regexpOffsets converts the result of FindStringSubmatchIndex to an array,
+// shifting the offsets by pos.
+func regexpOffsets(grb *GRuby, loc []int, pos int) Value {
+	offsets := make(Values, len(loc))
+	for i, offset := range loc {
+		if offset >= 0 {
+			offset += pos
+		}
+
+		offsets[i] = MustToRuby(grb, offset)
+	}
+
+	return MustToRuby(grb, offsets)
+}
+
+// regexpExpand expands the references in the replacement string of sub and
+// gsub: \0 to \9 and \& for the groups and \k<name> for the named ones.
+func regexpExpand(template string, match Value) (string, error) {
+	var out strings.Builder
+
+	group := func(index Value) error {
+		value, err := match.Call("[]", index)
+		if err != nil {
+			return err
+		}
+
+		if value.Type() != TypeNil {
+			out.WriteString(value.String())
+		}
+
+		return nil
+	}
+
+	grb := match.GRuby()
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '\\' || i+1 == len(template) {
+			out.WriteByte(c)
+
+			continue
+		}
+
+		next := template[i+1]
+
+		switch {
+		case next >= '0' && next <= '9':
+			if err := group(MustToRuby(grb, int(next-'0'))); err != nil {
+				return "", err
+			}
+		case next == '&':
+			if err := group(MustToRuby(grb, 0)); err != nil {
+				return "", err
+			}
+		case next == '\\':
+			out.WriteByte('\\')
+		case next == 'k' && strings.HasPrefix(template[i+2:], "<") && strings.Contains(template[i+2:], ">"):
+			name := template[i+3 : i+2+strings.Index(template[i+2:], ">")]
+			if err := group(MustToRuby(grb, name)); err != nil {
+				return "", err
+			}
+
+			i += len(name) + 2
+		default:
+			out.WriteByte(c)
+
+			continue
+		}
+
+		i++
+	}
+
+	return out.String(), nil
+}
+
+// goRegexpSource translates a Ruby regular expression to Go's syntax.
+func goRegexpSource(source string, options int) string {
+	var out strings.Builder
+
+	// ^ and $ always match at line boundaries in Ruby, the m option is Go's s.
+	out.WriteString("(?m")
+	if options&regexpIgnoreCase != 0 {
+		out.WriteString("i")
+	}
+
+	if options&regexpMultiline != 0 {
+		out.WriteString("s")
+	}
+
+	out.WriteString(")")
+
+	extended := options&regexpExtended != 0
+	inClass := false
+
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+
+		switch {
+		case c == '\\' && i+1 < len(source):
+			i++
+			out.WriteString(goRegexpEscape(source[i], inClass))
+		case c == '[' && inClass && strings.HasPrefix(source[i:], "[:"):
+			// POSIX classes, like [[:alpha:]].
+			end := strings.Index(source[i:], ":]")
+			if end < 0 {
+				out.WriteByte(c)
+
+				continue
+			}
+
+			out.WriteString(source[i : i+end+2])
+			i += end + 1
+		case c == '[':
+			inClass = true
+
+			out.WriteByte(c)
+		case c == ']':
+			inClass = false
+
+			out.WriteByte(c)
+		case extended && !inClass && strings.IndexByte(" \t\r\n\f\v", c) >= 0:
+		case extended && !inClass && c == '#':
+			for i+1 < len(source) && source[i+1] != '\n' {
+				i++
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return out.String()
+}
+
+// goRegexpEscape translates the escapes Ruby supports and Go doesn't.
+func goRegexpEscape(c byte, inClass bool) string {
+	switch {
+	case c == 'Z' && !inClass:
+		return `(?:\n?\z)`
+	case c == 'h' && inClass:
+		return `0-9a-fA-F`
+	case c == 'h':
+		return `[0-9a-fA-F]`
+	case c == 'H' && !inClass:
+		return `[^0-9a-fA-F]`
+	default:
+		return `\` + string(c)
+	}
+}
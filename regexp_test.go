@@ -0,0 +1,91 @@
+package gruby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestWithRegexp(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New(gruby.WithRegexp()))
+	defer grb.Close()
+
+	cases := map[string]string{
+		`"hello world" =~ /o w/`:                                    `4`,
+		`"hello" =~ /z/`:                                            `nil`,
+		`"key=value" =~ /(\w+)=(\w+)/; [$~[0], $1, $2]`:             `["key=value", "key", "value"]`,
+		`"a1b22c333".scan(/\d+/)`:                                   `["1", "22", "333"]`,
+		`"a=1, b=2".scan(/(\w)=(\d)/)`:                              `[["a", "1"], ["b", "2"]]`,
+		`"hello world".sub(/o/, "0")`:                               `"hell0 world"`,
+		`"hello world".gsub(/o/, "0")`:                              `"hell0 w0rld"`,
+		`"john smith".gsub(/(\w+)/) { |w| w.capitalize }`:           `"John Smith"`,
+		`"2024-01-15".sub(/(\d+)-(\d+)-(\d+)/, '\3/\2/\1')`:         `"15/01/2024"`,
+		`"x-y".sub(/(?<a>\w)-(?<b>\w)/, '\k<b>-\k<a> (\0)')`:        `"y-x (x-y)"`,
+		`"cat hat".gsub(/[ch]at/, "cat" => "dog", "hat" => "cap")`:  `"dog cap"`,
+		`"a, b,c ,d".split(/\s*,\s*/)`:                              `["a", "b", "c", "d"]`,
+		`"a1b2c".split(/(\d)/)`:                                     `["a", "1", "b", "2", "c"]`,
+		`"abc".split(//)`:                                           `["a", "b", "c"]`,
+		`"a,b,,".split(/,/)`:                                        `["a", "b"]`,
+		`"a,b,c".split(/,/, 2)`:                                     `["a", "b,c"]`,
+		`"a b c".split(" ")`:                                        `["a", "b", "c"]`,
+		`"HeLLo".match?(/hello/i)`:                                  `true`,
+		`"a\nb" =~ /a.b/`:                                           `nil`,
+		`"a\nb" =~ /a.b/m`:                                          `0`,
+		`"line1\nline2" =~ /^line2$/`:                               `6`,
+		`"ab12" =~ / \d+ # digits /x`:                               `2`,
+		`"ff" =~ /\A\h+\z/`:                                         `0`,
+		`case "2024" when /\A\d+\z/ then "number" else "other" end`: `"number"`,
+		`Regexp.new("a.c").match?("abc")`:                           `true`,
+		`Regexp.escape("a.c*")`:                                     `"a\\.c\\*"`,
+		`Regexp.union("a.b", /c+/).source`:                          `"a\\.b|(?:c+)"`,
+		`/ab/i.inspect`:                                             `"/ab/i"`,
+		`"foo bar".sub("bar", "baz")`:                               `"foo baz"`,
+		`s = "aaa"; s.gsub!(/a/, "b"); s`:                           `"bbb"`,
+		`"foo bar".match(/\bbar/, 4).begin(0)`:                      `4`,
+		`"foobar".match(/\bbar/, 3)`:                                `nil`,
+		`"ab".match(/^b/, 1)`:                                       `nil`,
+		`"a\nb".match(/^b/, 2).begin(0)`:                            `2`,
+		`"aaa".match(/aa/, 1).begin(0)`:                             `1`,
+		`"héllo".match(/l+/, 3)[0]`:                                 `"ll"`,
+		`Regexp.new("a").respond_to?(:__match)`:                     `false`,
+		`Regexp.respond_to?(:__expand)`:                             `false`,
+	}
+
+	for code, expected := range cases {
+		value, err := grb.LoadString(`(` + code + `).inspect`)
+		g.Expect(err).ToNot(HaveOccurred(), code)
+		g.Expect(value.String()).To(Equal(expected), code)
+	}
+
+	value, err := grb.LoadString(`
+m = "John Smith".match(/(?<first>\w+) (?<last>\w+)/)
+[m[0], m[:first], m["last"], m.pre_match, m.captures, m.named_captures].inspect
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["John Smith", "John", "Smith", "", ["John", "Smith"], {"first"=>"John", "last"=>"Smith"}]`))
+
+	// RE2 doesn't support backreferences and lookarounds.
+	value, err = grb.LoadString(`
+begin
+  Regexp.new("(a)\\1")
+rescue RegexpError => e
+  e.class.to_s
+end
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("RegexpError"))
+
+	for code, expected := range map[string]string{
+		`Regexp.new("a").send(:__match, "a", 2)`:   "position 2 out of string",
+		`Regexp.new("a").send(:__match, "a", -1)`:  "position -1 out of string",
+		`Regexp.new("a").send(:__match, "a", "0")`: "no implicit conversion of String into Integer",
+		`Regexp.new("a").send(:__match, :a, 0)`:    "wrong argument type Symbol (expected String)",
+	} {
+		_, err = grb.LoadString(code)
+		g.Expect(err).To(MatchError(expected), code)
+	}
+}
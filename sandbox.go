@@ -0,0 +1,203 @@
+package gruby
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SandboxPolicy configures what WithSandbox takes away from scripts.
+type SandboxPolicy struct {
+	// RemoveConstants lists classes and modules to remove, nested ones are
+	// written as "Outer::Inner". Missing constants are ignored, so the
+	// policy works with any gembox.
+	RemoveConstants []string
+	// UndefMethods lists methods to undefine, written as "Class#method" for
+	// instance methods and "Class.method" for singleton methods, like
+	// "Kernel#eval" and "Kernel.eval". Missing methods are ignored.
+	UndefMethods []string
+	// BlockStringEval makes instance_eval, class_eval and module_eval raise
+	// SecurityError when called with a string, they keep working with blocks.
+	BlockStringEval bool
+	// FreezeCoreClasses freezes every class and module defined when the
+	// sandbox is applied, except Object so scripts can still define methods
+	// and constants at the top-level. Defining a method in a frozen class
+	// raises FrozenError.
+	//
+	// As Object stays open, scripts can still define or redefine methods of
+	// Object, which every object inherits: class Object; def inspect; end;
+	// end changes inspect for all the objects that don't override it, and a
+	// top-level def puts shadows Kernel#puts. Scripts sharing a VM can't be
+	// isolated from each other with this option alone.
+	FreezeCoreClasses bool
+}
+
+// DefaultSandboxPolicy returns a policy suited for untrusted scripts: no
+// evaluation of strings, no access to the process, files and object space and
+// no monkey-patching of core classes other than Object, see
+// FreezeCoreClasses.
+func DefaultSandboxPolicy() SandboxPolicy {
+	return SandboxPolicy{
+		RemoveConstants: []string{"ObjectSpace", "GC", "IO", "File", "Dir", "Process", "Binding"},
+		UndefMethods: []string{
+			"Kernel#eval", "Kernel.eval",
+			"Kernel#binding",
+			"Kernel#exit", "Kernel.exit",
+			"Kernel#exit!", "Kernel.exit!",
+			"Kernel#abort", "Kernel.abort",
+			"Kernel#open", "Kernel.open",
+			"Kernel#system", "Kernel.system",
+			"Kernel#`", "Kernel.`",
+		},
+		BlockStringEval:   true,
+		FreezeCoreClasses: true,
+	}
+}
+
+// blockStringEvalCode wraps the eval methods, the original methods are only
+// reachable through the closures.
+const blockStringEvalCode = `
+[[BasicObject, :instance_eval], [Module, :class_eval], [Module, :module_eval]].each do |mod, name|
+  next unless mod.method_defined?(name)
+
+  original = mod.instance_method(name)
+  mod.send(:define_method, name) do |*args, &block|
+    raise SecurityError, "#{name} with a string is not allowed in the sandbox" unless args.empty?
+
+    original.bind(self).call(&block)
+  end
+end
+`
+
+// WithSandbox returns a Mutator restricting what scripts can do according to
+// the policy. It should be the last mutator passed to New: with
+// FreezeCoreClasses, defining methods on the frozen classes from Go fails
+// too.
+//
+// The sandbox only restricts Ruby, methods defined in Go are available to
+// scripts as usual. Debugging with the debug package needs Kernel#binding
+// and string evaluation, which the default policy removes.
+func WithSandbox(policy SandboxPolicy) Mutator {
+	return func(grb *GRuby) error {
+		securityErrorClass(grb)
+
+		for _, name := range policy.UndefMethods {
+			if err := grb.sandboxUndef(name); err != nil {
+				return fmt.Errorf("failed to undefine %s: %w", name, err)
+			}
+		}
+
+		if policy.BlockStringEval {
+			if _, err := grb.LoadString(blockStringEvalCode); err != nil {
+				return fmt.Errorf("failed to block string evaluation: %w", err)
+			}
+		}
+
+		for _, name := range policy.RemoveConstants {
+			if err := grb.sandboxRemoveConst(name); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+		}
+
+		if policy.FreezeCoreClasses {
+			if err := grb.sandboxFreeze(); err != nil {
+				return fmt.Errorf("failed to freeze core classes: %w", err)
+			}
+		}
+
+		return nil
+	}
+}
+
+// securityErrorClass returns SecurityError, defining it if the VM does not.
+func securityErrorClass(grb *GRuby) *Class {
+	return grb.errorClass("SecurityError", "Exception")
+}
+
+func (g *GRuby) sandboxUndef(name string) error {
+	owner, method, singleton := strings.Cut(name, ".")
+	if !singleton {
+		owner, method, _ = strings.Cut(name, "#")
+	}
+
+	receiver, err := g.sandboxConst(owner)
+	if err != nil || receiver == nil {
+		return err
+	}
+
+	if singleton {
+		if receiver, err = receiver.Call("singleton_class"); err != nil {
+			return err
+		}
+	}
+
+	_, err = receiver.Call("undef_method", g.symbol(method))
+
+	return ignoreNameError(err)
+}
+
+func (g *GRuby) sandboxRemoveConst(name string) error {
+	outer := Value(g.ObjectClass())
+
+	if i := strings.LastIndex(name, "::"); i >= 0 {
+		var err error
+		if outer, err = g.sandboxConst(name[:i]); err != nil || outer == nil {
+			return err
+		}
+
+		name = name[i+2:]
+	}
+
+	_, err := outer.Call("remove_const", g.symbol(name))
+
+	return ignoreNameError(err)
+}
+
+func (g *GRuby) sandboxFreeze() error {
+	constants, err := g.ObjectClass().Call("constants")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range MustToGo[Values](constants) {
+		value, cErr := g.ObjectClass().Call("const_get", name)
+		if cErr != nil {
+			return cErr
+		}
+
+		if value.Type() != TypeClass && value.Type() != TypeModule || name.String() == "Object" {
+			continue
+		}
+
+		if _, fErr := value.Call("freeze"); fErr != nil {
+			return fErr
+		}
+	}
+
+	return nil
+}
+
+// sandboxConst returns the constant with the given path, or nil if it is not
+// defined.
+func (g *GRuby) sandboxConst(path string) (Value, error) {
+	value, err := g.ObjectClass().Call("const_get", MustToRuby(g, path))
+	if err != nil {
+		return nil, ignoreNameError(err)
+	}
+
+	return value, nil
+}
+
+// ignoreNameError returns nil for NameError exceptions, raised when a
+// constant or method is not defined.
+func ignoreNameError(err error) error {
+	var exc *ExceptionError
+	if errors.As(err, &exc) {
+		isNameError, cErr := exc.Call("is_a?", exc.GRuby().Class("NameError", nil))
+		if cErr == nil && MustToGo[bool](isNameError) {
+			return nil
+		}
+	}
+
+	return err
+}
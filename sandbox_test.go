@@ -0,0 +1,91 @@
+package gruby_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestWithSandbox(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New(gruby.WithSandbox(gruby.DefaultSandboxPolicy())))
+	defer grb.Close()
+
+	escapes := map[string]string{
+		`eval("1 + 1")`:                         "NoMethodError",
+		`Kernel.eval("1 + 1")`:                  "NoMethodError",
+		`send(:eval, "1 + 1")`:                  "NoMethodError",
+		`method(:eval)`:                         "NameError",
+		`binding`:                               "NoMethodError",
+		`exit`:                                  "NoMethodError",
+		`Kernel.exit(1)`:                        "NoMethodError",
+		`ObjectSpace`:                           "NameError",
+		`Object.const_get(:GC)`:                 "NameError",
+		`File`:                                  "NameError",
+		`IO`:                                    "NameError",
+		`1.instance_eval("self")`:               "SecurityError",
+		`String.class_eval("def pwned; end")`:   "SecurityError",
+		`String.module_eval("def pwned; end")`:  "SecurityError",
+		`1.send(:instance_eval, "self")`:        "SecurityError",
+		`class String; def upcase; end; end`:    "FrozenError",
+		`String.send(:define_method, :x) { 1 }`: "FrozenError",
+		`module Kernel; def puts(*); end; end`:  "FrozenError",
+		`BasicObject.instance_method(:instance_eval).bind(1).call("self")`: "SecurityError",
+	}
+
+	for code, className := range escapes {
+		_, err := grb.LoadString(code)
+		g.Expect(err).To(HaveOccurred(), code)
+
+		var exc *gruby.ExceptionError
+		g.Expect(errors.As(err, &exc)).To(BeTrue(), code)
+
+		isA, cErr := exc.Call("is_a?", grb.Class(className, nil))
+		g.Expect(cErr).ToNot(HaveOccurred())
+		g.Expect(gruby.MustToGo[bool](isA)).To(BeTrue(), code+" raised "+exc.Class().String())
+	}
+
+	// Scripts can still do what scripts usually do.
+	value, err := grb.LoadString(`
+def double(x)
+  x * 2
+end
+
+class Greeter
+  def greet(name)
+    "hello #{name}"
+  end
+end
+
+Greeter.new.instance_eval { greet("world") } + double(21).to_s
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("hello world42"))
+}
+
+func TestWithSandbox_customPolicy(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New(gruby.WithSandbox(gruby.SandboxPolicy{
+		RemoveConstants:   []string{"Comparable", "Missing::Constant"},
+		UndefMethods:      []string{"String#upcase", "Missing#method", "Kernel#missing"},
+		BlockStringEval:   false,
+		FreezeCoreClasses: false,
+	})))
+	defer grb.Close()
+
+	_, err := grb.LoadString(`"a".upcase`)
+	g.Expect(err).To(MatchError(ContainSubstring("upcase")))
+
+	_, err = grb.LoadString(`Comparable`)
+	g.Expect(err).To(HaveOccurred())
+
+	value, err := grb.LoadString(`class String; def shout; downcase + "!"; end; end; "A".shout`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("a!"))
+}
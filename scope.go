@@ -0,0 +1,99 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+// Scope is an isolated top-level for scripts sharing a VM, see NewScope.
+type Scope struct {
+	grb    *GRuby
+	module *Class
+	self   Value
+}
+
+// NewScope creates a Scope, an isolated top-level for scripts loaded into the
+// same VM, like the ones of different tenants. It works like Ruby's
+// load(file, true): scripts run with an anonymous module as their namespace
+// and a new object extended by it as self. The constants, classes and methods
+// scripts define at the top-level go to the module, so they are only visible
+// to scripts loaded into the same scope, while everything defined before,
+// like the core classes, stays visible.
+//
+// Methods defined at the top-level can only be called from the top-level of
+// the scope, not from the methods of the classes defined in the scope.
+// Global variables are still shared.
+//
+// Close the scope when it is not needed anymore, so its objects can be
+// collected.
+func (g *GRuby) NewScope() (*Scope, error) {
+	module := newClass(g, C.mrb_module_new(g.state))
+
+	self, err := g.ObjectClass().New()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = self.Call("extend", module); err != nil {
+		return nil, err
+	}
+
+	C.mrb_gc_register(g.state, self.CValue())
+
+	return &Scope{
+		grb:    g,
+		module: module,
+		self:   self,
+	}, nil
+}
+
+// Close releases the scope, it must not be used anymore.
+func (s *Scope) Close() {
+	C.mrb_gc_unregister(s.grb.state, s.self.CValue())
+}
+
+// Module returns the module holding the constants, classes and methods
+// defined in the scope.
+func (s *Scope) Module() *Class {
+	return s.module
+}
+
+// Self returns the top-level self of the scope.
+func (s *Scope) Self() Value {
+	return s.self
+}
+
+// LoadString loads the given code, executes it in the scope, and returns
+// its final value.
+func (s *Scope) LoadString(code string) (Value, error) {
+	ctx := NewCompileContext(s.grb)
+	defer ctx.Close()
+
+	return s.LoadStringWithContext(code, ctx)
+}
+
+// LoadStringWithContext is LoadString with a compile context, to set the
+// filename of the code for instance.
+func (s *Scope) LoadStringWithContext(code string, ctx *CompileContext) (Value, error) {
+	noExec := C._go_mrb_context_no_exec(ctx.ctx)
+	defer C._go_mrb_context_set_no_exec(ctx.ctx, noExec)
+
+	C._go_mrb_context_set_no_exec(ctx.ctx, 1)
+
+	proc, err := s.grb.LoadStringWithContext(code, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Run(proc)
+}
+
+// Run executes the given value, which should be a top-level proc like the
+// ones returned by Parser.GenerateCode, in the scope. The proc itself is left
+// untouched, it can be run in other scopes.
+func (s *Scope) Run(v Value) (Value, error) {
+	value := C._go_mrb_run_under(s.grb.state, v.CValue(), s.self.CValue(), s.module.class)
+	if exc := checkException(s.grb); exc != nil {
+		return nil, exc
+	}
+
+	return s.grb.value(value), nil
+}
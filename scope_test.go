@@ -0,0 +1,97 @@
+package gruby_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestGRuby_NewScope(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	first, err := grb.NewScope()
+	g.Expect(err).ToNot(HaveOccurred())
+	defer first.Close()
+
+	second, err := grb.NewScope()
+	g.Expect(err).ToNot(HaveOccurred())
+	defer second.Close()
+
+	for name, scope := range map[string]*gruby.Scope{"first": first, "second": second} {
+		_, err = scope.LoadString(`
+NAME = "` + name + `"
+
+def greet
+  "hello from #{NAME}"
+end
+
+class Tenant
+  def name
+    NAME
+  end
+end
+`)
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	value, err := first.LoadString(`[greet, Tenant.new.name, "core".upcase].inspect`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal(`["hello from first", "first", "CORE"]`))
+
+	value, err = second.LoadString(`greet`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(value.String()).To(Equal("hello from second"))
+
+	g.Expect(grb.ConstDefined("NAME", grb.ObjectClass())).To(BeFalse())
+	g.Expect(grb.ConstDefined("NAME", first.Module())).To(BeTrue())
+
+	_, err = grb.LoadString(`greet`)
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = first.LoadString(`raise "boom"`)
+	g.Expect(err).To(MatchError("boom"))
+
+	parser := gruby.NewParser(grb)
+	defer parser.Close()
+
+	_, err = parser.Parse(`self`, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	value, err = second.Run(parser.GenerateCode())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	same, err := value.Call("equal?", second.Self())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gruby.MustToGo[bool](same)).To(BeTrue())
+
+	_, err = parser.Parse(`SHARED = true`, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	proc := parser.GenerateCode()
+
+	_, err = first.Run(proc)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = second.Run(proc)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(grb.ConstDefined("SHARED", first.Module())).To(BeTrue())
+	g.Expect(grb.ConstDefined("SHARED", second.Module())).To(BeTrue())
+
+	ctx := gruby.NewCompileContext(grb)
+	defer ctx.Close()
+	ctx.SetFilename("tenant.rb")
+
+	_, err = first.LoadStringWithContext("\nraise 'boom'", ctx)
+	g.Expect(err).To(HaveOccurred())
+
+	var exc *gruby.ExceptionError
+	g.Expect(errors.As(err, &exc)).To(BeTrue())
+	g.Expect(exc.File).To(Equal("tenant.rb"))
+	g.Expect(exc.Line).To(Equal(2))
+}
@@ -0,0 +1,122 @@
+package gruby
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// WithSlog returns a Mutator defining the Logger module, which forwards the
+// logs of scripts to logger:
+//
+//	Logger.info("user signed in", user: "alice", attempts: 2)
+//
+// Logger has the debug, info, warn and error methods, taking a message and
+// keyword arguments which become the attributes of the record, nested hashes
+// become groups. The file and line the method was called from are added as
+// the file and line attributes.
+func WithSlog(logger *slog.Logger) Mutator {
+	return func(grb *GRuby) error {
+		module := grb.DefineModule("Logger")
+
+		levels := map[string]slog.Level{
+			"debug": slog.LevelDebug,
+			"info":  slog.LevelInfo,
+			"warn":  slog.LevelWarn,
+			"error": slog.LevelError,
+		}
+
+		for name, level := range levels {
+			module.DefineClassMethod(name, slogMethod(logger, level), ArgsAny())
+		}
+
+		return nil
+	}
+}
+
+func slogMethod(logger *slog.Logger, level slog.Level) Func {
+	return func(grb *GRuby, self Value) (Value, Value) {
+		args := grb.GetArgs()
+
+		var attributes Value
+		if len(args) > 1 && args[len(args)-1].Type() == TypeHash {
+			attributes = args[len(args)-1]
+			args = args[:len(args)-1]
+		}
+
+		if len(args) != 1 {
+			message := "wrong number of arguments (given " + strconv.Itoa(len(args)) + ", expected 1)"
+
+			return nil, grb.newError(grb.Class("ArgumentError", nil), message)
+		}
+
+		ctx := context.Background()
+		if !logger.Enabled(ctx, level) {
+			return grb.TrueValue(), nil
+		}
+
+		var attrs []slog.Attr
+		if attributes != nil {
+			attrs = slogAttrs(attributes)
+		}
+
+		if backtrace := grb.Backtrace(); len(backtrace) > 0 {
+			attrs = append(attrs, slogSource(backtrace[0])...)
+		}
+
+		logger.LogAttrs(ctx, level, args[0].String(), attrs...)
+
+		return grb.TrueValue(), nil
+	}
+}
+
+// slogAttrs converts the entries of a Ruby hash to attributes.
+func slogAttrs(hash Value) []slog.Attr {
+	entries := Hash{hash}
+	keys := entries.Keys()
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.Attr{Key: key.String(), Value: slogValue(entries.Get(key))})
+	}
+
+	return attrs
+}
+
+func slogValue(value Value) slog.Value {
+	if value == nil {
+		return slog.AnyValue(nil)
+	}
+
+	switch value.Type() {
+	case TypeHash:
+		return slog.GroupValue(slogAttrs(value)...)
+	case TypeSymbol:
+		return slog.StringValue(value.String())
+	default:
+	}
+
+	var result any
+	if err := Decode(&result, value); err != nil {
+		// Objects which can't be decoded are logged as strings.
+		return slog.StringValue(value.String())
+	}
+
+	return slog.AnyValue(result)
+}
+
+// slogSource returns the file and line attributes from a backtrace entry,
+// like "script.rb:12:in foo".
+func slogSource(entry string) []slog.Attr {
+	parts := strings.SplitN(entry, ":", 3)
+
+	attrs := []slog.Attr{slog.String("file", parts[0])}
+	if len(parts) > 1 {
+		if line, err := strconv.Atoi(parts[1]); err == nil {
+			attrs = append(attrs, slog.Int("line", line))
+		}
+	}
+
+	return attrs
+}
@@ -0,0 +1,64 @@
+package gruby_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestWithSlog(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	var out bytes.Buffer
+
+	logger := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{
+		AddSource: false,
+		Level:     slog.LevelInfo,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+
+			return attr
+		},
+	}))
+
+	grb := gruby.Must(gruby.New(gruby.WithSlog(logger)))
+	defer grb.Close()
+
+	_, _, err := grb.LoadFile("script.rb", `Logger.debug("hidden")
+Logger.info("signed in", user: "alice", attempts: 2, admin: false, role: :owner, request: { id: 7 })
+Logger.error("failed")
+`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	decoder := json.NewDecoder(&out)
+
+	var record map[string]any
+	g.Expect(decoder.Decode(&record)).To(Succeed())
+	g.Expect(record).To(Equal(map[string]any{
+		"level":    "INFO",
+		"msg":      "signed in",
+		"user":     "alice",
+		"attempts": float64(2),
+		"admin":    false,
+		"role":     "owner",
+		"request":  map[string]any{"id": float64(7)},
+		"file":     "script.rb",
+		"line":     float64(2),
+	}))
+
+	record = nil
+	g.Expect(decoder.Decode(&record)).To(Succeed())
+	g.Expect(record).To(HaveKeyWithValue("level", "ERROR"))
+	g.Expect(record).To(HaveKeyWithValue("line", float64(3)))
+	g.Expect(decoder.More()).To(BeFalse())
+
+	_, err = grb.LoadString(`Logger.warn`)
+	g.Expect(err).To(MatchError("wrong number of arguments (given 0, expected 1)"))
+}
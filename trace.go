@@ -0,0 +1,177 @@
+package gruby
+
+// #include "gruby.h"
+import "C"
+
+// TraceEventType is the kind of a TraceEvent.
+type TraceEventType int
+
+const (
+	// TraceLine is emitted when execution moves to a new line.
+	TraceLine = TraceEventType(C.GO_TRACE_LINE)
+	// TraceCall is emitted when a method defined in Ruby is called.
+	TraceCall = TraceEventType(C.GO_TRACE_CALL)
+	// TraceReturn is emitted when a method defined in Ruby returns.
+	TraceReturn = TraceEventType(C.GO_TRACE_RETURN)
+	// TraceRaise is emitted when an exception is raised.
+	TraceRaise = TraceEventType(C.GO_TRACE_RAISE)
+)
+
+// String returns the name of the event type.
+func (t TraceEventType) String() string {
+	switch t {
+	case TraceLine:
+		return "line"
+	case TraceCall:
+		return "call"
+	case TraceReturn:
+		return "return"
+	case TraceRaise:
+		return "raise"
+	}
+
+	return "unknown"
+}
+
+// TraceEvent describes what the VM is executing, see SetTraceHook.
+type TraceEvent struct {
+	Type TraceEventType
+
+	// File and Line are the location being executed, as set with
+	// CompileContext.SetFilename. For TraceRaise they point to where the
+	// exception was raised.
+	File string
+	Line int
+
+	// Method is the name of the current method, it is empty at the top-level
+	// and in class bodies.
+	Method string
+	// Class is the class of the receiver (self).
+	Class string
+	// Self is the receiver of the current frame. It is only valid until the
+	// hook returns.
+	Self Value
+	// Depth is the depth of the call stack, it grows with every method or
+	// block call.
+	Depth int
+
+	// Exception is the raised exception for TraceRaise.
+	Exception *ExceptionError
+
+	irep *C.mrb_irep
+}
+
+// TraceHook is the signature of a function observing the execution, see
+// SetTraceHook.
+type TraceHook func(ev TraceEvent)
+
+type traceListener func(ev *TraceEvent)
+
+// SetTraceHook installs a hook that is called when execution moves to a new
+// line, a method defined in Ruby is called or returns and an exception is
+// raised, similar to Ruby's TracePoint. Passing nil removes the hook.
+//
+// Code executed by the hook itself is not traced. Tracing slows the VM down,
+// remove the hook when it is not needed.
+func (g *GRuby) SetTraceHook(hook TraceHook) {
+	if g.removeTraceHook != nil {
+		g.removeTraceHook()
+		g.removeTraceHook = nil
+	}
+
+	if hook != nil {
+		g.removeTraceHook = g.AddTraceHook(hook)
+	}
+}
+
+// AddTraceHook installs a hook like SetTraceHook, but does not replace the
+// hook installed with it or other hooks added with AddTraceHook. It is meant
+// for tools, like debuggers, working alongside the user's hook. Call the
+// returned function to remove the hook.
+func (g *GRuby) AddTraceHook(hook TraceHook) func() {
+	return g.addTraceListener(func(ev *TraceEvent) {
+		hook(*ev)
+	})
+}
+
+//export goTraceEvent
+func goTraceEvent(state *C.mrb_state, event C.int, irep *C.mrb_irep, pc C.int, regs *C.mrb_value) {
+	grb := states.get(state)
+	if grb == nil || len(grb.traceListeners) == 0 {
+		return
+	}
+
+	ev := &TraceEvent{
+		Type:      TraceEventType(event),
+		File:      C.GoString(C.mrb_debug_get_filename(state, irep, C.uint32_t(pc))),
+		Line:      int(C.mrb_debug_get_line(state, irep, C.uint32_t(pc))),
+		Method:    C.GoString(C._go_mrb_sym_name(state, state.c.ci.mid)),
+		Class:     C.GoString(C.mrb_obj_classname(state, *regs)),
+		Self:      grb.value(*regs),
+		Depth:     int(C._go_mrb_ci_depth(state)),
+		Exception: nil,
+		irep:      irep,
+	}
+
+	if ev.Type == TraceRaise {
+		ev.Exception = newExceptionValue(grb)
+		if len(ev.Exception.Backtrace) > 0 {
+			ev.File = ev.Exception.File
+			ev.Line = ev.Exception.Line
+		}
+	}
+
+	grb.emitTraceEvent(ev)
+}
+
+// traceUncaughtException reports exceptions that were not rescued in Ruby,
+// the code fetch hook never sees them.
+func (g *GRuby) traceUncaughtException(exc *ExceptionError) {
+	if len(g.traceListeners) == 0 || C._go_trace_take_exc(g.state) == 0 {
+		return
+	}
+
+	g.emitTraceEvent(&TraceEvent{
+		Type:      TraceRaise,
+		File:      exc.File,
+		Line:      exc.Line,
+		Method:    "",
+		Class:     "",
+		Self:      g.nilV,
+		Depth:     0,
+		Exception: exc,
+		irep:      nil,
+	})
+}
+
+func (g *GRuby) emitTraceEvent(ev *TraceEvent) {
+	for _, listener := range g.traceListeners {
+		listener(ev)
+	}
+}
+
+func (g *GRuby) addTraceListener(listener traceListener) func() {
+	if len(g.traceListeners) == 0 {
+		C._go_trace_enable(g.state)
+	}
+
+	id := g.nextTraceListener
+	g.nextTraceListener++
+	g.traceListeners[id] = listener
+
+	return func() {
+		g.removeTraceListener(id)
+	}
+}
+
+func (g *GRuby) removeTraceListener(id int) {
+	if _, ok := g.traceListeners[id]; !ok {
+		return
+	}
+
+	delete(g.traceListeners, id)
+
+	if len(g.traceListeners) == 0 {
+		C._go_trace_disable(g.state)
+	}
+}
@@ -0,0 +1,146 @@
+package gruby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func loadTraced(g G, grb *gruby.GRuby, code string) []gruby.TraceEvent {
+	var events []gruby.TraceEvent
+
+	grb.SetTraceHook(func(ev gruby.TraceEvent) {
+		events = append(events, ev)
+	})
+	defer grb.SetTraceHook(nil)
+
+	ctx := gruby.NewCompileContext(grb)
+	defer ctx.Close()
+	ctx.SetFilename("trace.rb")
+
+	_, err := grb.LoadStringWithContext(code, ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return events
+}
+
+func TestSetTraceHook(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	events := loadTraced(g, grb, `def add(a, b)
+  a + b
+end
+
+add(1, 2)
+`)
+
+	var lines []int
+	for _, ev := range events {
+		if ev.Type == gruby.TraceLine {
+			g.Expect(ev.File).To(Equal("trace.rb"))
+			lines = append(lines, ev.Line)
+		}
+	}
+	g.Expect(lines).To(ContainElements(1, 5, 2))
+
+	g.Expect(events).To(ContainElement(And(
+		HaveField("Type", gruby.TraceCall),
+		HaveField("Method", "add"),
+		HaveField("Class", "Object"),
+	)))
+	g.Expect(events).To(ContainElement(And(
+		HaveField("Type", gruby.TraceReturn),
+		HaveField("Method", "add"),
+	)))
+
+	count := 0
+	grb.SetTraceHook(func(gruby.TraceEvent) { count++ })
+	grb.SetTraceHook(nil)
+
+	_, err := grb.LoadString(`add(1, 2)`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(count).To(BeZero())
+}
+
+func TestSetTraceHook_raise(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	events := loadTraced(g, grb, `begin
+  raise ArgumentError, "rescued"
+rescue ArgumentError
+end
+`)
+
+	var raises []gruby.TraceEvent
+	for _, ev := range events {
+		if ev.Type == gruby.TraceRaise {
+			raises = append(raises, ev)
+		}
+	}
+
+	g.Expect(raises).To(HaveLen(1))
+	g.Expect(raises[0].Exception.Message).To(Equal("rescued"))
+	g.Expect(raises[0].Line).To(Equal(2))
+
+	raises = nil
+	grb.SetTraceHook(func(ev gruby.TraceEvent) {
+		if ev.Type == gruby.TraceRaise {
+			raises = append(raises, ev)
+		}
+	})
+
+	_, err := grb.LoadString(`raise "uncaught"`)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(raises).To(HaveLen(1))
+	g.Expect(raises[0].Exception.Message).To(Equal("uncaught"))
+}
+
+func TestAddTraceHook(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	depths := map[int]int{}
+	remove := grb.AddTraceHook(func(ev gruby.TraceEvent) {
+		if ev.Type == gruby.TraceLine {
+			depths[ev.Line] = ev.Depth
+		}
+	})
+
+	events := loadTraced(g, grb, `def add(a, b)
+  a + b
+end
+
+add(1, 2)
+`)
+	g.Expect(events).ToNot(BeEmpty())
+	g.Expect(depths[2]).To(BeNumerically(">", depths[5]))
+
+	remove()
+	clear(depths)
+
+	_, err := grb.LoadString(`add(1, 2)`)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(depths).To(BeEmpty())
+}
+
+func TestTraceEventTypeString(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	g.Expect(gruby.TraceLine.String()).To(Equal("line"))
+	g.Expect(gruby.TraceCall.String()).To(Equal("call"))
+	g.Expect(gruby.TraceReturn.String()).To(Equal("return"))
+	g.Expect(gruby.TraceRaise.String()).To(Equal("raise"))
+}
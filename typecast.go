@@ -5,6 +5,9 @@ import "C"
 
 import (
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 )
 
 type (
@@ -68,7 +71,7 @@ func ToGo[T SupportedTypes](value Value) (T, error) {
 	switch any(empty).(type) {
 	case string:
 		str := C.mrb_obj_as_string(value.GRuby().state, value.CValue())
-		result = C.GoString(C._go_RSTRING_PTR(str))
+		result = C.GoStringN(C._go_RSTRING_PTR(str), C.int(C._go_RSTRING_LEN(str)))
 	case int:
 		result = int(C._go_mrb_fixnum(value.CValue()))
 	case float32:
@@ -97,7 +100,14 @@ func MustToGo[T SupportedTypes](value Value) T {
 	return Must(ToGo[T](value))
 }
 
-func ToRuby[T SupportedTypes](grb *GRuby, value T) (Value, error) {
+// ToRuby converts a Go value to a Ruby value, the opposite of Decode.
+//
+// Booleans, numbers and strings map to their Ruby equivalents, slices and
+// arrays to arrays, maps to hashes and nil to nil. Byte slices become
+// strings. Structs become hashes, their keys are named after the fields like
+// Decode expects them: lowercased or from the mruby tag, embedded structs
+// tagged with squash are flattened. Values are returned as they are.
+func ToRuby[T any](grb *GRuby, value T) (Value, error) {
 	val := any(value)
 
 	switch tVal := val.(type) {
@@ -107,20 +117,176 @@ func ToRuby[T SupportedTypes](grb *GRuby, value T) (Value, error) {
 		}
 		return grb.FalseValue(), nil
 	case string:
-		cstr := C.CString(tVal)
-		defer freeStr(cstr)
-		return grb.value(C.mrb_str_new_cstr(grb.state, cstr)), nil
+		return grb.newString(tVal), nil
 	case int:
 		return grb.value(C.mrb_fixnum_value(C.mrb_int(tVal))), nil
 	case float32:
-		return grb.value(C.mrb_float_value(grb.state, C.mrb_float(C.long(tVal)))), nil
+		return grb.value(C.mrb_float_value(grb.state, C.mrb_float(tVal))), nil
 	case float64:
-		return grb.value(C.mrb_float_value(grb.state, C.mrb_float(C.long(tVal)))), nil
+		return grb.value(C.mrb_float_value(grb.state, C.mrb_float(tVal))), nil
+	case Hash:
+		return tVal.Value, nil
+	case Values:
+		if len(tVal) == 0 {
+			return grb.value(C.mrb_ary_new(grb.state)), nil
+		}
+
+		argv := make([]C.mrb_value, len(tVal))
+		for i, item := range tVal {
+			argv[i] = item.CValue()
+		}
+
+		return grb.value(C.mrb_ary_new_from_values(grb.state, C.mrb_int(len(argv)), &argv[0])), nil
+	case Value:
+		return tVal, nil
 	}
 
-	return nil, fmt.Errorf("%w: '%+v'", ErrUnknownType, value)
+	return toRubyValue(grb, reflect.ValueOf(value))
 }
 
-func MustToRuby[T SupportedTypes](grb *GRuby, value T) Value {
+func MustToRuby[T any](grb *GRuby, value T) Value {
 	return Must(ToRuby[T](grb, value))
 }
+
+func toRubyValue(grb *GRuby, val reflect.Value) (Value, error) { //nolint:cyclop
+	if !val.IsValid() || val.Kind() == reflect.Pointer && val.IsNil() {
+		return grb.NilValue(), nil
+	}
+
+	if val.Kind() != reflect.Interface && val.CanInterface() {
+		if v, ok := val.Interface().(Value); ok {
+			return v, nil
+		}
+	}
+
+	switch val.Kind() {
+	case reflect.Bool:
+		if val.Bool() {
+			return grb.TrueValue(), nil
+		}
+
+		return grb.FalseValue(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return grb.value(C.mrb_int_value(grb.state, C.mrb_int(val.Int()))), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if val.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: %d overflows Integer", ErrUnknownType, val.Uint())
+		}
+
+		return grb.value(C.mrb_int_value(grb.state, C.mrb_int(val.Uint()))), nil
+	case reflect.Float32, reflect.Float64:
+		return grb.value(C.mrb_float_value(grb.state, C.mrb_float(val.Float()))), nil
+	case reflect.String:
+		return grb.newString(val.String()), nil
+	case reflect.Slice:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return grb.newString(string(val.Bytes())), nil
+		}
+
+		return toRubyArray(grb, val)
+	case reflect.Array:
+		return toRubyArray(grb, val)
+	case reflect.Map:
+		return toRubyMap(grb, val)
+	case reflect.Pointer, reflect.Interface:
+		if val.Kind() == reflect.Interface && val.IsNil() {
+			return grb.NilValue(), nil
+		}
+
+		return toRubyValue(grb, val.Elem())
+	case reflect.Struct:
+		hash := Hash{grb.value(C.mrb_hash_new(grb.state))}
+		if err := toRubyStruct(grb, val, hash); err != nil {
+			return nil, err
+		}
+
+		return hash.Value, nil
+	default:
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownType, val.Type())
+}
+
+func toRubyArray(grb *GRuby, val reflect.Value) (Value, error) {
+	array := grb.value(C.mrb_ary_new_capa(grb.state, C.mrb_int(val.Len())))
+
+	for i := range val.Len() {
+		idx := grb.ArenaSave()
+
+		item, err := toRubyValue(grb, val.Index(i))
+		if err != nil {
+			grb.ArenaRestore(idx)
+			return nil, err
+		}
+
+		C.mrb_ary_push(grb.state, array.CValue(), item.CValue())
+		grb.ArenaRestore(idx)
+	}
+
+	return array, nil
+}
+
+func toRubyMap(grb *GRuby, val reflect.Value) (Value, error) {
+	hash := Hash{grb.value(C.mrb_hash_new(grb.state))}
+
+	iter := val.MapRange()
+	for iter.Next() {
+		idx := grb.ArenaSave()
+
+		key, err := toRubyValue(grb, iter.Key())
+		if err != nil {
+			grb.ArenaRestore(idx)
+			return nil, err
+		}
+
+		item, err := toRubyValue(grb, iter.Value())
+		if err != nil {
+			grb.ArenaRestore(idx)
+			return nil, err
+		}
+
+		hash.Set(key, item)
+		grb.ArenaRestore(idx)
+	}
+
+	return hash.Value, nil
+}
+
+func toRubyStruct(grb *GRuby, val reflect.Value, hash Hash) error {
+	structType := val.Type()
+
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		tagParts := strings.Split(field.Tag.Get(tagName), ",")
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && len(tagParts) > 1 && tagParts[1] == "squash" {
+			if err := toRubyStruct(grb, val.Field(i), hash); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.ToLower(field.Name)
+		if tagParts[0] != "" {
+			name = tagParts[0]
+		}
+
+		idx := grb.ArenaSave()
+
+		item, err := toRubyValue(grb, val.Field(i))
+		if err != nil {
+			grb.ArenaRestore(idx)
+			return err
+		}
+
+		hash.Set(grb.newString(name), item)
+		grb.ArenaRestore(idx)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package gruby_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/gruby"
+)
+
+func TestToRubyValues(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	value := gruby.MustToRuby(grb, gruby.Values{gruby.MustToRuby(grb, "foo"), gruby.MustToRuby(grb, 42)})
+	g.Expect(value.Type()).To(Equal(gruby.TypeArray))
+
+	inspect, err := value.Call("inspect")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inspect.String()).To(Equal(`["foo", 42]`))
+
+	empty := gruby.MustToRuby(grb, gruby.Values{})
+	g.Expect(gruby.MustToGo[gruby.Values](empty)).To(BeEmpty())
+}
+
+func TestToRubyHash(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	value, err := grb.LoadString(`{"foo" => "bar"}`)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	hash := gruby.MustToGo[gruby.Hash](value)
+	g.Expect(gruby.MustToRuby(grb, hash)).To(Equal(value))
+}
+
+func TestToRubyGoValues(t *testing.T) {
+	t.Parallel()
+	g := NewG(t)
+
+	grb := gruby.Must(gruby.New())
+	defer grb.Close()
+
+	type user struct {
+		Name  string
+		Score float64 `mruby:"points"`
+		Tags  []string
+	}
+
+	value := gruby.MustToRuby(grb, []user{{Name: "alice", Score: 1.5, Tags: []string{"admin"}}})
+
+	inspect, err := value.Call("inspect")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(inspect.String()).To(Equal(`[{"name"=>"alice", "points"=>1.5, "tags"=>["admin"]}]`))
+
+	size, err := gruby.MustToRuby(grb, "a\x00b").Call("bytesize")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gruby.MustToGo[int](size)).To(Equal(3))
+
+	g.Expect(gruby.MustToRuby(grb, value)).To(Equal(value))
+	g.Expect(gruby.MustToRuby[any](grb, nil).Type()).To(Equal(gruby.TypeNil))
+
+	_, err = gruby.ToRuby(grb, make(chan int))
+	g.Expect(err).To(MatchError(gruby.ErrUnknownType))
+}